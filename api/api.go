@@ -0,0 +1,101 @@
+package api
+
+import (
+	"cfddns/cfddns"
+	"cfddns/log"
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/goccy/go-json"
+	"go.uber.org/zap"
+)
+
+// Server serves status of the daemon over HTTP.
+type Server struct {
+	Resolver  *cfddns.Resolver
+	Publisher *cfddns.Publisher
+	Health    *cfddns.Health
+
+	// Refresh triggers an update cycle as soon as possible.
+	Refresh func()
+
+	// HealthyWithin is the max time since last successful update cycle to be considered healthy.
+	// Zero means healthy after any successful cycle, as in one shot mode there's no next cycle.
+	HealthyWithin time.Duration
+}
+
+type healthResponse struct {
+	Healthy bool `json:"healthy"`
+	cfddns.HealthStatus
+}
+
+type statusResponse struct {
+	Health    healthResponse         `json:"health"`
+	Addresses []cfddns.AddressStatus `json:"addresses"`
+	Domains   []cfddns.DomainStatus  `json:"domains"`
+}
+
+func (s *Server) health() healthResponse {
+	status := s.Health.Status()
+	healthy := status.LastSuccess != nil && (s.HealthyWithin == 0 || time.Since(*status.LastSuccess) <= s.HealthyWithin)
+	return healthResponse{Healthy: healthy, HealthStatus: status}
+}
+
+func writeJSON(ctx context.Context, w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.S(ctx).Warnw("failed writing response", zap.Error(err))
+	}
+}
+
+func (s *Server) handler(ctx context.Context) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		health := s.health()
+		code := http.StatusOK
+		if !health.Healthy {
+			code = http.StatusServiceUnavailable
+		}
+
+		writeJSON(ctx, w, code, health)
+	})
+
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(ctx, w, http.StatusOK, statusResponse{
+			Health:    s.health(),
+			Addresses: s.Resolver.Status(),
+			Domains:   s.Publisher.Status(),
+		})
+	})
+
+	mux.HandleFunc("POST /refresh", func(w http.ResponseWriter, r *http.Request) {
+		log.S(ctx).Infow("refresh requested", "remote", r.RemoteAddr)
+		s.Refresh()
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	return mux
+}
+
+// Serve listens at addr and serves the API, until ctx is done.
+func (s *Server) Serve(ctx context.Context, addr string) error {
+	ctx = log.SWith(ctx, log.Stage("api"), "listen", addr)
+
+	server := &http.Server{Addr: addr, Handler: s.handler(ctx)}
+	go func() {
+		<-ctx.Done()
+		_ = server.Close()
+	}()
+
+	log.S(ctx).Infow("serving api")
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.S(ctx).Errorw("api server failed", zap.Error(err))
+		return err
+	}
+
+	return nil
+}
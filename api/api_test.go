@@ -0,0 +1,39 @@
+package api
+
+import (
+	"cfddns/cfddns"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHealth(t *testing.T) {
+	tests := []struct {
+		name    string
+		within  time.Duration
+		results []error
+		want    bool
+	}{
+		{name: "no run yet", within: time.Minute},
+		{name: "succeeded", within: time.Minute, results: []error{nil}, want: true},
+		{name: "failed only", within: time.Minute, results: []error{errors.New("x")}},
+		{name: "failed after success", within: time.Minute, results: []error{nil, errors.New("x")}, want: true},
+		{name: "success too old", within: time.Nanosecond, results: []error{nil}},
+		{name: "one shot succeeded", results: []error{nil}, want: true},
+		{name: "one shot failed", results: []error{errors.New("x")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{Health: &cfddns.Health{}, HealthyWithin: tt.within}
+			for _, err := range tt.results {
+				s.Health.Record(err)
+			}
+
+			time.Sleep(time.Millisecond)
+			if got := s.health().Healthy; got != tt.want {
+				t.Errorf("healthy = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package cfddns
+
+import (
+	"cfddns/config"
+	"cfddns/log"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBreakerFailures    = 3
+	defaultBreakerCooldown    = 5 * time.Minute
+	defaultBreakerMaxCooldown = time.Hour
+)
+
+// breaker is a circuit breaker of a single source. After failures in a row the source is
+// demoted, and is only queried when no other source is available, until cooldown passes and
+// it's probed again. Each failed probe doubles the cooldown, up to maxCooldown.
+//
+// A nil breaker never opens.
+type breaker struct {
+	failures    int
+	cooldown    time.Duration
+	maxCooldown time.Duration
+
+	mu        sync.Mutex
+	count     int
+	current   time.Duration
+	openUntil time.Time
+}
+
+func newBreaker(c config.Breaker) (*breaker, error) {
+	if c.Failures < 0 {
+		return nil, nil
+	}
+
+	b := &breaker{
+		failures:    c.Failures,
+		cooldown:    time.Duration(c.Cooldown),
+		maxCooldown: time.Duration(c.MaxCooldown),
+	}
+
+	if b.failures == 0 {
+		b.failures = defaultBreakerFailures
+	}
+
+	if b.cooldown == 0 {
+		b.cooldown = defaultBreakerCooldown
+	}
+
+	if b.maxCooldown == 0 {
+		b.maxCooldown = max(defaultBreakerMaxCooldown, b.cooldown)
+	}
+
+	if b.cooldown < 0 || b.maxCooldown < b.cooldown {
+		return nil, fmt.Errorf("bad breaker cooldown %s, max %s", b.cooldown, b.maxCooldown)
+	}
+
+	b.current = b.cooldown
+	return b, nil
+}
+
+// available reports whether the source should be queried: the circuit is closed, or it's
+// open but cooldown has passed, so the source is probed.
+func (b *breaker) available(ctx context.Context) bool {
+	if b == nil {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.openUntil.IsZero() {
+		return true
+	}
+
+	if time.Now().Before(b.openUntil) {
+		return false
+	}
+
+	log.S(ctx).Infow("probing source", "failures", b.count)
+	return true
+}
+
+func (b *breaker) succeeded(ctx context.Context) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.openUntil.IsZero() {
+		log.S(ctx).Infow("source circuit closed", "failures", b.count)
+	}
+
+	b.count = 0
+	b.current = b.cooldown
+	b.openUntil = time.Time{}
+}
+
+func (b *breaker) failed(ctx context.Context) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.count++
+	switch {
+	case !b.openUntil.IsZero():
+		// Probing failed, or the source is used as a last resort while demoted.
+		if time.Now().Before(b.openUntil) {
+			return
+		}
+
+		b.current = min(b.current*2, b.maxCooldown)
+		b.openUntil = time.Now().Add(b.current)
+		log.S(ctx).Warnw("source circuit reopened", "failures", b.count, "cooldown", b.current)
+	case b.count >= b.failures:
+		b.openUntil = time.Now().Add(b.current)
+		log.S(ctx).Warnw("source circuit opened", "failures", b.count, "cooldown", b.current)
+	}
+}
@@ -0,0 +1,275 @@
+package cfddns
+
+import (
+	"cfddns/common"
+	"cfddns/config"
+	"cfddns/ddns"
+	"cfddns/hooks"
+	"cfddns/log"
+	"cfddns/notify"
+	"cfddns/sources"
+	"cfddns/transformers"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+type familySet uint8
+
+const familyAny = familySet(1<<common.IPv4 | 1<<common.IPv6)
+
+func familyOf(f common.Family) familySet {
+	return familySet(1 << f)
+}
+
+type checkedAddress struct {
+	direct     familySet
+	transform  familySet
+	references []string
+
+	// visit state of reference walk: 0 for unvisited, 1 for visiting, 2 for done.
+	state    int
+	families familySet
+}
+
+type checker struct {
+	problems  []error
+	addresses map[string]*checkedAddress
+}
+
+func (c *checker) report(format string, args ...any) {
+	c.problems = append(c.problems, fmt.Errorf(format, args...))
+}
+
+func (c *checker) families(name string, chain []string) familySet {
+	addr := c.addresses[name]
+	switch addr.state {
+	case 1:
+		cycle := slices.Concat(chain[slices.Index(chain, name):], []string{name})
+		c.report("address %q: reference cycle: %s", name, strings.Join(cycle, " -> "))
+		return familyAny
+	case 2:
+		return addr.families
+	}
+
+	addr.state = 1
+	families := addr.direct
+	for _, ref := range addr.references {
+		if _, exist := c.addresses[ref]; !exist {
+			c.report("address %q: reference to non-exist address %q", name, ref)
+			families |= familyAny
+			continue
+		}
+
+		families |= c.families(ref, append(chain, name))
+	}
+
+	addr.families = families & addr.transform
+	addr.state = 2
+	return addr.families
+}
+
+func (c *checker) checkAddress(ctx context.Context, addr config.IPAddress) *checkedAddress {
+	node := &checkedAddress{transform: familyAny}
+
+	if len(addr.Sources) == 0 {
+		c.report("address %q: no source configured", addr.Name)
+	}
+
+	for _, s := range addr.Sources {
+		if s.Type == "reference" {
+			node.references = append(node.references, s.Source)
+		}
+	}
+
+	res, err := newIPResolver(ctx, addr)
+	if err != nil {
+		c.report("address %q: %w", addr.Name, err)
+		node.direct = familyAny
+		return node
+	}
+
+	for i, s := range addr.Sources {
+		if s.Type == "reference" {
+			continue
+		}
+
+		if hinter, ok := res.sources[i].(sources.FamilyHinter); ok {
+			if family, ok := hinter.Family(); ok {
+				node.direct |= familyOf(family)
+				continue
+			}
+		}
+
+		node.direct |= familyAny
+	}
+
+	for _, t := range res.transformers {
+		if hinter, ok := t.(transformers.FamilyHinter); ok {
+			if family, ok := hinter.Family(); ok {
+				node.transform &= familyOf(family)
+			}
+		}
+	}
+
+	return node
+}
+
+func inZone(domain, zone string) bool {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	zone = strings.ToLower(strings.TrimSuffix(zone, "."))
+	return domain == zone || strings.HasSuffix(domain, "."+zone)
+}
+
+// Check statically validates conf without accessing network, and returns all problems found.
+func Check(ctx context.Context, conf config.Config) []error {
+	ctx = log.SWith(ctx, log.Stage("check"))
+	c := &checker{addresses: map[string]*checkedAddress{}}
+
+	if len(conf.Provider) == 0 {
+		c.report("no provider configured")
+	}
+
+	if err := checkServiceName(conf.Service.Name); err != nil {
+		c.report("%w", err)
+	}
+
+	if conf.Service.GarbageCollect != common.GCOff && conf.Service.Name == "" {
+		c.report("garbage collect requires service name")
+	}
+
+	zones := map[string][]string{}
+	types := map[string]string{}
+	for _, provider := range conf.Provider {
+		provider = normalizeProvider(provider)
+		if _, exist := zones[provider.Name]; exist {
+			c.report("provider %q: duplicated name", provider.Name)
+			continue
+		}
+
+		zones[provider.Name] = nil
+		types[provider.Name] = provider.Type
+		if _, ok := ddns.Providers[provider.Type]; !ok {
+			c.report("provider %q: unknown provider type %q", provider.Name, provider.Type)
+			continue
+		}
+
+		if _, err := ddns.WithRetry(nil, provider.Retry); err != nil {
+			c.report("provider %q: %w", provider.Name, err)
+		}
+
+		names, err := ddns.ZoneNames[provider.Type](provider)
+		if err != nil {
+			c.report("provider %q: bad config: %w", provider.Name, err)
+			continue
+		}
+
+		if len(names) == 0 {
+			c.report("provider %q: no zone configured", provider.Name)
+		}
+
+		zones[provider.Name] = names
+	}
+
+	for _, addr := range conf.Address {
+		if _, exist := c.addresses[addr.Name]; exist {
+			c.report("address %q: duplicated name", addr.Name)
+			continue
+		}
+
+		c.addresses[addr.Name] = c.checkAddress(ctx, addr)
+	}
+
+	for _, addr := range conf.Address {
+		c.families(addr.Name, nil)
+	}
+
+	type recordKey struct {
+		provider, domain, nsType, mark string
+	}
+
+	records := map[recordKey]struct{}{}
+	for _, domain := range conf.Domain {
+		name := fmt.Sprintf("%s %s", domain.Domain, domain.Type)
+
+		var need familySet
+		switch domain.Type {
+		case "A":
+			need = familyOf(common.IPv4)
+		case "AAAA":
+			need = familyOf(common.IPv6)
+		default:
+			c.report("domain %q: unsupported record type %q", name, domain.Type)
+		}
+
+		if addr, exist := c.addresses[domain.Address]; !exist {
+			c.report("domain %q: non-exist address %q", name, domain.Address)
+		} else if need != 0 && addr.families&need == 0 {
+			c.report("domain %q: address %q never yields IP of required family", name, domain.Address)
+		}
+
+		provider := domain.Provider
+		if provider == "" && len(conf.Provider) == 1 {
+			provider = normalizeProvider(conf.Provider[0]).Name
+		}
+
+		if provider == "" {
+			c.report("domain %q: provider must be set when multiple providers configured", name)
+		} else if names, exist := zones[provider]; !exist {
+			c.report("domain %q: non-exist provider %q", name, provider)
+		} else if names != nil {
+			found := false
+			for _, zone := range names {
+				if inZone(domain.Domain, zone) {
+					found = true
+					break
+				}
+			}
+
+			if !found {
+				c.report("domain %q: not in any zone of provider %q", name, provider)
+			}
+		}
+
+		if check, ok := ddns.CheckOptions[types[provider]]; ok {
+			options := ddns.RecordOptions{TTL: domain.TTL, Proxied: domain.Proxied, Tags: domain.Tags}
+			if err := check(options); err != nil {
+				c.report("domain %q: bad record options: %w", name, err)
+			}
+		}
+
+		if domain.MinInterval < 0 {
+			c.report("domain %q: negative min interval", name)
+		}
+
+		for _, hook := range domain.Hooks {
+			if _, err := hooks.New(ctx, hook); err != nil {
+				c.report("domain %q: bad hook: %w", name, err)
+			}
+		}
+
+		mark := ""
+		if domain.Mark != nil {
+			mark = *domain.Mark
+		}
+
+		key := recordKey{provider, strings.ToLower(domain.Domain), domain.Type, mark}
+		if _, exist := records[key]; exist {
+			c.report("domain %q: duplicated with same mark %q", name, mark)
+		}
+		records[key] = struct{}{}
+	}
+
+	if _, err := notify.New(ctx, conf.Notify, conf.Service.Name); err != nil {
+		c.report("bad notify config: %w", err)
+	}
+
+	for _, hook := range conf.Hook {
+		if _, err := hooks.New(ctx, hook); err != nil {
+			c.report("bad hook: %w", err)
+		}
+	}
+
+	return c.problems
+}
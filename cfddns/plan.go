@@ -0,0 +1,86 @@
+package cfddns
+
+import (
+	"cfddns/log"
+	"context"
+	"go.uber.org/zap"
+	"net"
+)
+
+type PlanAction string
+
+const (
+	PlanCreate    PlanAction = "create"
+	PlanUpdate    PlanAction = "update"
+	PlanUnchanged PlanAction = "unchanged"
+	PlanSkip      PlanAction = "skipped"
+	PlanDelete    PlanAction = "delete"
+)
+
+// PlanEntry describes what publishing would do to a single record.
+type PlanEntry struct {
+	Action   PlanAction `json:"action"`
+	Provider string     `json:"provider"`
+	Domain   string     `json:"domain"`
+	Type     string     `json:"type"`
+	Mark     string     `json:"mark"`
+	Address  string     `json:"address,omitempty"`
+	OldIP    string     `json:"old_ip,omitempty"`
+	NewIP    string     `json:"new_ip,omitempty"`
+}
+
+func (e PlanEntry) Changed() bool {
+	switch e.Action {
+	case PlanCreate, PlanUpdate, PlanDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+func (r *recordPublisher) plan(ctx context.Context, ips []net.IP) (entries []PlanEntry) {
+	entry := PlanEntry{
+		Provider: r.providerName,
+		Domain:   r.record.Domain,
+		Type:     r.record.Type,
+		Mark:     r.record.Mark,
+		Address:  r.name,
+	}
+
+	// Plan with records provider has, as restored ones may be stale.
+	if r.restored {
+		if err := r.find(ctx); err != nil {
+			log.S(ctx).Warnw("planning with records restored from state", zap.Error(err))
+		}
+	}
+
+	wanted := r.wanted(ctx, ips)
+	if len(wanted) == 0 {
+		entry.Action = PlanSkip
+		return []PlanEntry{entry}
+	}
+
+	for _, op := range r.reconcile(wanted) {
+		entry := entry
+		entry.Action = op.action
+		entry.OldIP = op.record.Address
+		entry.NewIP = op.ip
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+// Plan reports what Publish would do with state, without writing anything.
+func (p *Publisher) Plan(ctx context.Context, state map[string][]net.IP) (entries []PlanEntry) {
+	ctx = log.SWith(ctx, log.Stage("plan"))
+
+	for _, domain := range p.domains {
+		for _, entry := range domain.plan(ctx, state[domain.name]) {
+			log.S(ctx).Debugw("planned record", "plan", entry)
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries
+}
@@ -1,108 +1,752 @@
 package cfddns
 
 import (
+	"cfddns/common"
 	"cfddns/config"
 	"cfddns/ddns"
+	"cfddns/hooks"
 	"cfddns/log"
+	"cfddns/metrics"
+	"cfddns/notify"
 	"context"
+	"errors"
 	"fmt"
-	"go.uber.org/zap"
 	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goccy/go-json"
+	"go.uber.org/zap"
 )
 
+// DefaultMark is the mark of records managed by this instance, followed by "@" and the service
+// name if set. Mark of a domain is appended after "/", which service names can't contain, so
+// records of instance "home" are never confused with those of "home-lab".
 var DefaultMark = "cfddns"
 
+// legacyMark is DefaultMark of older versions, joining service name and domain mark with "-".
+// Records marked so are taken over on lookup.
+var legacyMark = "cfddns"
+
+var serviceName string
+
+// SetServiceName makes marks of records include the service name.
+func SetServiceName(name string) error {
+	if err := checkServiceName(name); err != nil {
+		return err
+	}
+
+	serviceName = name
+	if name != "" {
+		DefaultMark = "cfddns@" + name
+		legacyMark = "cfddns-" + name
+	}
+
+	return nil
+}
+
+func checkServiceName(name string) error {
+	if strings.ContainsAny(name, "/ \t") {
+		return fmt.Errorf("service name %q must not contain slash or space", name)
+	}
+
+	return nil
+}
+
+// owned reports whether a record mark is set by this instance.
+func owned(mark string) bool {
+	return mark == DefaultMark || strings.HasPrefix(mark, DefaultMark+"/")
+}
+
 type recordPublisher struct {
-	name     string
-	provider ddns.Interface
-	record   ddns.Record
+	name         string
+	providerName string
+	provider     ddns.Interface
+	hooks        []*hooks.Hook
+	dispatcher   *hooks.Dispatcher
+	// record holds domain, type, mark and options shared by all records of the set.
+	record  ddns.Record
+	records []ddns.Record
+	// legacyMark is the mark of records set by older versions.
+	legacyMark string
+	// minInterval is the minimum time between two updates of records.
+	minInterval time.Duration
+
+	statusMu sync.Mutex
+	status   DomainStatus
+
+	// restored is set if records are loaded from state file, and not verified with provider yet.
+	// They are trusted until a write using their handles fails.
+	restored bool
+	// foundAt is when records were last looked up from provider, or restored.
+	foundAt time.Time
 }
 
-func (r *recordPublisher) init(ctx context.Context, config config.Domain) error {
+// addresses returns content of current records.
+func (r *recordPublisher) addresses() []string {
+	addresses := make([]string, 0, len(r.records))
+	for _, record := range r.records {
+		addresses = append(addresses, record.Address)
+	}
+
+	return addresses
+}
+
+func (r *recordPublisher) find(ctx context.Context) error {
+	records, err := r.provider.FindRecord(ctx, r.record)
+	if err != nil {
+		log.S(ctx).Errorw("failed read record info", zap.Error(err))
+		return err
+	}
+
+	// Records of older versions are rewritten with current mark on next update.
+	if len(records) == 0 && r.legacyMark != r.record.Mark {
+		legacy := r.record
+		legacy.Mark = r.legacyMark
+		if records, err = r.provider.FindRecord(ctx, legacy); err != nil {
+			log.S(ctx).Errorw("failed read record info", "mark", legacy.Mark, zap.Error(err))
+			return err
+		}
+
+		if len(records) != 0 {
+			log.S(ctx).Infow("found records of legacy mark, taking over", "mark", legacy.Mark)
+		}
+	}
+
+	r.records = records
+	if len(records) != 0 {
+		log.S(ctx).Infow("found records", "ips", r.addresses())
+	} else {
+		log.S(ctx).Infow("no record found")
+	}
+
+	r.restored = false
+	r.foundAt = time.Now()
+	return nil
+}
+
+func (r *recordPublisher) restore(ctx context.Context, st *State) bool {
+	states := st.records(r.providerName, r.record.Domain, r.record.Type, r.record.Mark)
+	if len(states) == 0 {
+		return false
+	}
+
+	records := make([]ddns.Record, 0, len(states))
+	for _, rs := range states {
+		handle, err := r.provider.DecodeHandle(rs.Handle)
+		if err != nil {
+			log.S(ctx).Warnw("ignore bad record handle in state", zap.Error(err))
+			return false
+		}
+
+		record := r.record
+		record.Handle = handle
+		record.Address = rs.Content
+		record.Options = rs.Options
+		records = append(records, record)
+	}
+
+	r.records = records
+	r.status.UpdatedAt = states[0].UpdatedAt
+	r.restored = true
+	r.foundAt = time.Now()
+
+	log.S(ctx).Infow("restored records from state", "ips", r.addresses())
+	return true
+}
+
+func (r *recordPublisher) init(ctx context.Context, config config.Domain, st *State) error {
 	r.name = config.Address
 	ctx = log.SWith(ctx, "name", r.name)
 
 	r.record.Domain = config.Domain
 	r.record.Type = config.Type
 	r.record.Mark = DefaultMark
+	r.legacyMark = legacyMark
 	if config.Mark != nil {
-		r.record.Mark += "-" + *config.Mark
+		r.record.Mark += "/" + *config.Mark
+		r.legacyMark += "-" + *config.Mark
 	}
 
-	records, err := r.provider.FindRecord(ctx, r.record)
+	options, err := r.provider.Options(ddns.RecordOptions{TTL: config.TTL, Proxied: config.Proxied, Tags: config.Tags})
 	if err != nil {
-		log.S(ctx).Errorw("failed read record info", zap.Error(err))
-		return err
+		log.S(ctx).Errorw("bad record options", zap.Error(err))
+		return fmt.Errorf("bad record options: %w", err)
 	}
 
-	if len(records) > 1 {
-		log.S(ctx).Errorw("inconsistent state: found multiple records", "count", len(records))
-		return fmt.Errorf("inconsistent state: found multiple records")
+	r.record.Options = options
+	r.minInterval = time.Duration(config.MinInterval)
+	if r.minInterval < 0 {
+		log.S(ctx).Errorw("bad min interval", "min_interval", r.minInterval)
+		return fmt.Errorf("bad min interval %s", r.minInterval)
 	}
 
-	if len(records) != 0 {
-		r.record = records[0]
-		log.S(ctx).Infow("found record", "ip", r.record.Address)
-	} else {
-		log.S(ctx).Infow("no record found")
+	if st == nil || !r.restore(ctx, st) {
+		if err := r.find(ctx); err != nil {
+			return err
+		}
+	}
+
+	r.status = DomainStatus{
+		Provider:  r.providerName,
+		Domain:    r.record.Domain,
+		Type:      r.record.Type,
+		Mark:      r.record.Mark,
+		Address:   r.name,
+		Content:   r.addresses(),
+		UpdatedAt: r.status.UpdatedAt,
 	}
 
 	return nil
 }
 
-func (r *recordPublisher) update(ctx context.Context, ip net.IP) error {
-	if r.record.Address == ip.String() {
-		log.S(ctx).Infow("IP didn't change, skip update", "ip", ip, "domain", r.record.Domain, "ns_type", r.record.Type)
+func (r *recordPublisher) setStatus(updated bool, err error) {
+	r.statusMu.Lock()
+	defer r.statusMu.Unlock()
+
+	now := time.Now()
+	r.status.CheckedAt = &now
+	r.status.Content = r.addresses()
+	if updated {
+		r.status.UpdatedAt = &now
+	}
+
+	r.status.Error = ""
+	if err != nil {
+		r.status.Error = err.Error()
+	}
+}
+
+// nextUpdate returns the earliest time records may be updated again, if min interval is set and
+// records were updated before.
+func (r *recordPublisher) nextUpdate() (time.Time, bool) {
+	r.statusMu.Lock()
+	defer r.statusMu.Unlock()
+
+	if r.minInterval == 0 || r.status.UpdatedAt == nil {
+		return time.Time{}, false
+	}
+
+	return r.status.UpdatedAt.Add(r.minInterval), true
+}
+
+func (r *recordPublisher) getStatus() DomainStatus {
+	r.statusMu.Lock()
+	defer r.statusMu.Unlock()
+
+	return r.status
+}
+
+// wanted returns ips of the record family as record content, in order and without duplicates.
+func (r *recordPublisher) wanted(ctx context.Context, ips []net.IP) (wanted []string) {
+	for _, ip := range ips {
+		if (ip.To4() != nil) != (r.record.Type == "A") {
+			log.S(ctx).Warnw("ignore ip not matching record type", log.IP(ip), "ns_type", r.record.Type)
+			continue
+		}
+
+		if !slices.Contains(wanted, ip.String()) {
+			wanted = append(wanted, ip.String())
+		}
+	}
+
+	return wanted
+}
+
+type recordOp struct {
+	action PlanAction
+	// record is the existing record to update or delete, or the template to create from.
+	record ddns.Record
+	ip     string
+}
+
+// reconcile computes operations turning current records into a set having content of exactly wanted.
+// Records already having a wanted content are kept, or updated if their options drifted. Surplus
+// records are reused for missing content, and the rest of them are deleted.
+func (r *recordPublisher) reconcile(wanted []string) (ops []recordOp) {
+	var surplus []ddns.Record
+	kept := map[string]bool{}
+	for _, record := range r.records {
+		if slices.Contains(wanted, record.Address) && !kept[record.Address] {
+			kept[record.Address] = true
+			action := PlanUnchanged
+			if !record.Options.Matches(r.record.Options) || record.Mark != r.record.Mark {
+				action = PlanUpdate
+			}
+
+			ops = append(ops, recordOp{action: action, record: record, ip: record.Address})
+			continue
+		}
+
+		surplus = append(surplus, record)
+	}
+
+	for _, ip := range wanted {
+		if kept[ip] {
+			continue
+		}
+
+		if len(surplus) != 0 {
+			ops = append(ops, recordOp{action: PlanUpdate, record: surplus[0], ip: ip})
+			surplus = surplus[1:]
+		} else {
+			ops = append(ops, recordOp{action: PlanCreate, record: r.record, ip: ip})
+		}
+	}
+
+	for _, record := range surplus {
+		ops = append(ops, recordOp{action: PlanDelete, record: record})
+	}
+
+	return ops
+}
+
+// notify dispatches hooks for a record change.
+func (r *recordPublisher) notify(ctx context.Context, action PlanAction, oldIP, newIP string) {
+	if len(r.hooks) == 0 {
+		return
+	}
+
+	r.dispatcher.Dispatch(ctx, r.hooks, hooks.Event{
+		Action:   string(action),
+		Provider: r.providerName,
+		Domain:   r.record.Domain,
+		Type:     r.record.Type,
+		Mark:     r.record.Mark,
+		Address:  r.name,
+		OldIP:    oldIP,
+		NewIP:    newIP,
+		Time:     time.Now(),
+	})
+}
+
+// apply runs ops against provider. Records are updated to what's known to exist afterward,
+// even if some of the operations failed. stale is set if an operation using handle of existing
+// record failed, which may be changed outside.
+func (r *recordPublisher) apply(ctx context.Context, ops []recordOp) (changed, stale bool, err error) {
+	var errs []error
+	var records []ddns.Record
+	for _, op := range ops {
+		ctx := log.SWith(ctx, "domain", r.record.Domain, "ns_type", r.record.Type, "ip", op.ip, "old_ip", op.record.Address)
+
+		switch op.action {
+		case PlanUnchanged:
+			records = append(records, op.record)
+		case PlanCreate, PlanUpdate:
+			record := op.record
+			record.Address = op.ip
+			record.Mark = r.record.Mark
+			record.Options = r.record.Options
+			if op.action == PlanCreate {
+				record.Handle = nil
+			} else if record.Options.Tags == nil {
+				// Keep tags set by others, as tags are not managed.
+				record.Options.Tags = op.record.Options.Tags
+			}
+
+			written, err := r.provider.WriteRecord(ctx, record)
+			if err != nil {
+				errs = append(errs, err)
+				if op.action == PlanUpdate {
+					records = append(records, op.record)
+					stale = true
+				}
+
+				continue
+			}
+
+			log.S(ctx).Infow("record written", "action", op.action, "options", record.Options, "old_options", op.record.Options)
+			records = append(records, written)
+			changed = true
+			r.notify(ctx, op.action, op.record.Address, op.ip)
+		case PlanDelete:
+			if err := r.provider.DeleteRecord(ctx, op.record); err != nil {
+				errs = append(errs, err)
+				records = append(records, op.record)
+				stale = true
+				continue
+			}
+
+			log.S(ctx).Infow("surplus record deleted")
+			changed = true
+			r.notify(ctx, op.action, op.record.Address, "")
+		}
+	}
+
+	r.records = records
+	return changed, stale, errors.Join(errs...)
+}
+
+// holdBack turns updates and deletes in ops into unchanged ones if records were updated within
+// min interval. Missing records are always created.
+func (r *recordPublisher) holdBack(ctx context.Context, ops []recordOp, wanted []string) []recordOp {
+	next, ok := r.nextUpdate()
+	if !ok || !time.Now().Before(next) {
+		return ops
+	}
+
+	deferred := false
+	for i, op := range ops {
+		if op.action == PlanUpdate || op.action == PlanDelete {
+			ops[i] = recordOp{action: PlanUnchanged, record: op.record, ip: op.record.Address}
+			deferred = true
+		}
+	}
+
+	if deferred {
+		log.S(ctx).Infow("records update deferred by min interval", "ips", wanted, "current", r.addresses(),
+			"domain", r.record.Domain, "ns_type", r.record.Type, "next_update_at", next)
+	}
+
+	return ops
+}
+
+// driftDue reports whether records should be looked up to find changes made outside, as
+// interval passed since last lookup.
+func (r *recordPublisher) driftDue(interval time.Duration) bool {
+	return time.Since(r.foundAt) >= interval
+}
+
+func (r *recordPublisher) update(ctx context.Context, ips []net.IP, refresh bool) error {
+	labels := []string{r.record.Domain, r.record.Type, r.record.Mark}
+
+	if refresh {
+		if err := r.find(ctx); err != nil {
+			metrics.DomainUpdateFailures.WithLabelValues(labels...).Inc()
+			err = fmt.Errorf("failed find records: %w", err)
+			r.setStatus(false, err)
+			return err
+		}
+	}
+
+	wanted := r.wanted(ctx, ips)
+	if len(wanted) == 0 {
+		err := fmt.Errorf("no ip of record type")
+		r.setStatus(false, err)
+		return err
+	}
+
+	ops := r.reconcile(wanted)
+	if !slices.ContainsFunc(ops, func(op recordOp) bool { return op.action != PlanUnchanged }) {
+		log.S(ctx).Infow("IP didn't change, skip update", "ips", wanted, "domain", r.record.Domain, "ns_type", r.record.Type)
+		metrics.DomainLastSuccess.WithLabelValues(labels...).SetToCurrentTime()
+		r.setStatus(false, nil)
 		return nil
 	}
 
-	oldIP := r.record.Address
-	r.record.Address = ip.String()
+	ops = r.holdBack(ctx, ops, wanted)
+	if !slices.ContainsFunc(ops, func(op recordOp) bool { return op.action != PlanUnchanged }) {
+		r.setStatus(false, nil)
+		return nil
+	}
+
+	changed, stale, err := r.apply(ctx, ops)
+	if err != nil && stale {
+		// Known records, like ones restored from state, may have been changed outside. Look them
+		// up and try once more.
+		log.S(ctx).Warnw("failed writing known records, looking them up", zap.Error(err))
+		if fErr := r.find(ctx); fErr != nil {
+			err = errors.Join(err, fmt.Errorf("failed find records: %w", fErr))
+		} else {
+			var retried bool
+			retried, _, err = r.apply(ctx, r.holdBack(ctx, r.reconcile(wanted), wanted))
+			changed = changed || retried
+		}
+	}
 
-	record, err := r.provider.WriteRecord(ctx, r.record)
 	if err != nil {
-		return fmt.Errorf("failed update domain: %w", err)
+		metrics.DomainUpdateFailures.WithLabelValues(labels...).Inc()
+		err = fmt.Errorf("failed update domain: %w", err)
+		r.setStatus(changed, err)
+		return err
 	}
 
-	log.S(ctx).Infow("record updated", "ip", ip, "old_ip", oldIP, "domain", r.record.Domain, "ns_type", r.record.Type)
-	r.record = record
+	log.S(ctx).Infow("records updated", "ips", wanted, "domain", r.record.Domain, "ns_type", r.record.Type)
+	metrics.DomainUpdates.WithLabelValues(labels...).Inc()
+	metrics.DomainLastSuccess.WithLabelValues(labels...).SetToCurrentTime()
+	r.setStatus(true, nil)
 	return nil
 }
 
 type Publisher struct {
-	domains []*recordPublisher
+	// DryRun makes Publish only report planned changes instead of writing records.
+	DryRun bool
+
+	// CheckDrift makes Publish look up records before updating once DriftInterval passed since
+	// last lookup, to correct records changed outside, instead of trusting records known from
+	// last update.
+	CheckDrift    bool
+	DriftInterval time.Duration
+
+	// Notifier is told about publish failures, if set.
+	Notifier *notify.Notifier
+
+	domains    []*recordPublisher
+	providers  map[string]ddns.Interface
+	dispatcher hooks.Dispatcher
+}
+
+// WaitHooks blocks until all hooks triggered by record changes finished.
+func (p *Publisher) WaitHooks() {
+	p.dispatcher.Wait()
 }
 
-func (p *Publisher) Publish(ctx context.Context, state map[string]net.IP) error {
+func (p *Publisher) Publish(ctx context.Context, state map[string][]net.IP) error {
+	if p.DryRun {
+		for _, entry := range p.Plan(ctx, state) {
+			if entry.Changed() {
+				log.S(ctx).Infow("dry run, skip writing record", "plan", entry)
+			}
+		}
+
+		return nil
+	}
+
 	ctx = log.SWith(ctx, log.Stage("update"))
+
+	var errs []error
 	for _, domain := range p.domains {
-		ip := state[domain.name]
-		if ip == nil {
+		ips := state[domain.name]
+		if len(ips) == 0 {
 			log.S(ctx).Warnw("ip not resolved, cannot update domain", "name", domain.name)
 			continue
 		}
 
-		// Intentionally ignored. Partial success is better than all fail.
-		_ = domain.update(ctx, ip)
+		// Keep updating the rest. Partial success is better than all fail.
+		subject := fmt.Sprintf("domain %q", domain.record.Domain+" "+domain.record.Type)
+		if err := domain.update(ctx, ips, p.CheckDrift && domain.driftDue(p.DriftInterval)); err != nil {
+			errs = append(errs, fmt.Errorf("%s %s: %w", domain.record.Domain, domain.record.Type, err))
+			p.Notifier.Failed(ctx, common.EventPublishFailed, subject, err)
+		} else {
+			p.Notifier.Succeeded(ctx, subject)
+		}
 	}
 
-	return nil
+	return errors.Join(errs...)
 }
 
-func NewPublisher(ctx context.Context, pc config.CloudflareConfig, dc []config.Domain) (*Publisher, error) {
-	ctx = log.SWith(ctx, log.Stage("init:publisher"))
-	p := &Publisher{}
+func (p *Publisher) state() ([]RecordState, error) {
+	var records []RecordState
+	for _, domain := range p.domains {
+		for _, record := range domain.records {
+			handle, err := json.Marshal(record.Handle)
+			if err != nil {
+				return nil, fmt.Errorf("failed encoding record handle: %w", err)
+			}
+
+			records = append(records, RecordState{
+				Provider:  domain.providerName,
+				Domain:    record.Domain,
+				Type:      record.Type,
+				Mark:      record.Mark,
+				Content:   record.Address,
+				Options:   record.Options,
+				Handle:    handle,
+				UpdatedAt: domain.getStatus().UpdatedAt,
+			})
+		}
+	}
+
+	return records, nil
+}
+
+// Status returns publish state of all domains, in configured order.
+func (p *Publisher) Status() (status []DomainStatus) {
+	status = make([]DomainStatus, 0, len(p.domains))
+	for _, domain := range p.domains {
+		status = append(status, domain.getStatus())
+	}
+
+	return status
+}
+
+// CollectGarbage deletes records marked by this instance but not backed by any configured domain.
+// If dryRun is set, such records are only reported.
+func (p *Publisher) CollectGarbage(ctx context.Context, dryRun bool) (orphans []PlanEntry, err error) {
+	ctx = log.SWith(ctx, log.Stage("gc"), "dry_run", dryRun)
+
+	// Without service name, records of every named instance would look like ours.
+	if serviceName == "" {
+		log.S(ctx).Errorw("garbage collect requires service name, refused")
+		return nil, fmt.Errorf("garbage collect requires service name")
+	}
+
+	type recordKey struct {
+		provider, domain, nsType, mark string
+	}
+
+	backed := map[recordKey]struct{}{}
+	for _, domain := range p.domains {
+		key := recordKey{domain.providerName, strings.ToLower(domain.record.Domain), domain.record.Type, domain.record.Mark}
+		backed[key] = struct{}{}
+	}
+
+	for name, provider := range p.providers {
+		ctx := log.SWith(ctx, "provider", name)
 
-	pro, err := ddns.Providers["cloudflare"](ctx, pc)
+		records, err := provider.ListRecords(ctx, DefaultMark)
+		if err != nil {
+			log.S(ctx).Errorw("failed list records", zap.Error(err))
+			return nil, fmt.Errorf("failed list records: %w", err)
+		}
+
+		for _, record := range records {
+			if !owned(record.Mark) {
+				continue
+			}
+
+			key := recordKey{name, strings.ToLower(record.Domain), record.Type, record.Mark}
+			if _, exist := backed[key]; exist {
+				continue
+			}
+
+			ctx := log.SWith(ctx, "domain", record.Domain, "ns_type", record.Type, "ip", record.Address, "mark", record.Mark)
+			orphans = append(orphans, PlanEntry{
+				Action:   PlanDelete,
+				Provider: name,
+				Domain:   record.Domain,
+				Type:     record.Type,
+				Mark:     record.Mark,
+				OldIP:    record.Address,
+			})
+
+			if dryRun {
+				log.S(ctx).Infow("found orphaned record, would delete")
+				continue
+			}
+
+			// Intentionally ignored. Remaining records are still worth cleaning.
+			if err := provider.DeleteRecord(ctx, record); err != nil {
+				log.S(ctx).Errorw("failed delete orphaned record", zap.Error(err))
+				continue
+			}
+
+			log.S(ctx).Infow("orphaned record deleted")
+		}
+	}
+
+	log.S(ctx).Infow("garbage collect finished", "orphans", len(orphans))
+
+	return orphans, nil
+}
+
+func normalizeProvider(pc config.Provider) config.Provider {
+	if pc.Type == "" {
+		pc.Type = "cloudflare"
+	}
+
+	if pc.Name == "" {
+		pc.Name = pc.Type
+	}
+
+	return pc
+}
+
+func newProvider(ctx context.Context, pc config.Provider) (ddns.Interface, error) {
+	ctx = log.SWith(ctx, "provider", pc.Name, "provider_type", pc.Type)
+
+	create, ok := ddns.Providers[pc.Type]
+	if !ok {
+		log.S(ctx).Errorw("unknown provider type")
+		return nil, fmt.Errorf("unknown provider type")
+	}
+
+	pro, err := create(ctx, pc)
 	if err != nil {
-		log.S(ctx).Errorw("failed loading provider", "provider", "cloudflare", zap.Error(err))
+		log.S(ctx).Errorw("failed loading provider", zap.Error(err))
 		return nil, fmt.Errorf("failed loading provider: %w", err)
 	}
 
+	// Retry outside of instrument, so that every attempt is recorded.
+	retrying, err := ddns.WithRetry(ddns.Instrument(pc.Name, pro), pc.Retry)
+	if err != nil {
+		log.S(ctx).Errorw("bad retry config", zap.Error(err))
+		return nil, fmt.Errorf("bad retry config: %w", err)
+	}
+
+	return retrying, nil
+}
+
+func newHooks(ctx context.Context, hc []config.Hook) ([]*hooks.Hook, error) {
+	var list []*hooks.Hook
+	for _, c := range hc {
+		hook, err := hooks.New(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+
+		list = append(list, hook)
+	}
+
+	return list, nil
+}
+
+// NewPublisher creates Publisher for domains in dc. Hooks in hc run on changes of any domain.
+// If st is not nil, records found in it are used instead of looking up from providers.
+func NewPublisher(ctx context.Context, pc []config.Provider, dc []config.Domain, hc []config.Hook, st *State) (*Publisher, error) {
+	ctx = log.SWith(ctx, log.Stage("init:publisher"))
+	p := &Publisher{providers: map[string]ddns.Interface{}}
+
+	defaultProvider := ""
+	for _, provider := range pc {
+		provider = normalizeProvider(provider)
+
+		if _, exist := p.providers[provider.Name]; exist {
+			log.S(ctx).Errorw("duplicated provider name", "provider", provider.Name)
+			return nil, fmt.Errorf("duplicated provider name %q", provider.Name)
+		}
+
+		pro, err := newProvider(ctx, provider)
+		if err != nil {
+			return nil, err
+		}
+
+		p.providers[provider.Name] = pro
+		defaultProvider = provider.Name
+	}
+
+	globalHooks, err := newHooks(ctx, hc)
+	if err != nil {
+		return nil, err
+	}
+
+	// Domains can omit provider only if there's no ambiguity.
+	if len(p.providers) != 1 {
+		defaultProvider = ""
+	}
+
 	for _, domain := range dc {
-		rp := &recordPublisher{provider: pro}
+		name := domain.Provider
+		if name == "" {
+			if defaultProvider == "" {
+				log.S(ctx).Errorw("provider must be set when multiple providers configured", "domain", domain.Domain, "ns_type", domain.Type)
+				return nil, fmt.Errorf("provider not set for domain %s", domain.Domain)
+			}
+
+			name = defaultProvider
+		}
+
+		pro, exist := p.providers[name]
+		if !exist {
+			log.S(ctx).Errorw("non-exist provider", "domain", domain.Domain, "ns_type", domain.Type, "provider", name)
+			return nil, fmt.Errorf("non-exist provider %q", name)
+		}
+
+		domainHooks, err := newHooks(ctx, domain.Hooks)
+		if err != nil {
+			return nil, err
+		}
+
+		rp := &recordPublisher{
+			providerName: name,
+			provider:     pro,
+			hooks:        append(slices.Clip(globalHooks), domainHooks...),
+			dispatcher:   &p.dispatcher,
+		}
 
-		if err := rp.init(ctx, domain); err != nil {
+		if err := rp.init(ctx, domain, st); err != nil {
 			log.S(ctx).Errorw("failed init domain", "domain", domain.Domain, "ns_type", domain.Type, zap.Error(err))
 			return nil, err
 		}
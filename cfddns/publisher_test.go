@@ -0,0 +1,492 @@
+package cfddns
+
+import (
+	"cfddns/common"
+	"cfddns/config"
+	"cfddns/ddns"
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/goccy/go-json"
+)
+
+// fakeProvider keeps records in memory. Handles are record IDs.
+type fakeProvider struct {
+	mu      sync.Mutex
+	records map[int]ddns.Record
+	nextID  int
+	finds   int
+	writes  int
+}
+
+// fakeProviders are used by providers of type "fake", by name of the provider.
+var fakeProviders = map[string]*fakeProvider{}
+
+func init() {
+	ddns.Providers["fake"] = func(ctx context.Context, pc config.Provider) (ddns.Interface, error) {
+		p, ok := fakeProviders[pc.Name]
+		if !ok {
+			return nil, fmt.Errorf("no fake provider %q", pc.Name)
+		}
+
+		return p, nil
+	}
+}
+
+func newFakeProvider(t *testing.T) (*fakeProvider, []config.Provider) {
+	p := &fakeProvider{records: map[int]ddns.Record{}}
+	fakeProviders[t.Name()] = p
+	t.Cleanup(func() { delete(fakeProviders, t.Name()) })
+	return p, []config.Provider{{Name: t.Name(), Type: "fake"}}
+}
+
+func (p *fakeProvider) FindRecord(ctx context.Context, r ddns.Record) (records []ddns.Record, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.finds++
+	for _, record := range p.records {
+		if record.Domain == r.Domain && record.Type == r.Type && record.Mark == r.Mark {
+			records = append(records, record)
+		}
+	}
+
+	return records, nil
+}
+
+func (p *fakeProvider) WriteRecord(ctx context.Context, r ddns.Record) (ddns.Record, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.writes++
+	if r.Handle == nil {
+		p.nextID++
+		r.Handle = p.nextID
+	} else if _, exist := p.records[r.Handle.(int)]; !exist {
+		return r, fmt.Errorf("record %d not found", r.Handle)
+	}
+
+	p.records[r.Handle.(int)] = r
+	return r, nil
+}
+
+func (p *fakeProvider) DeleteRecord(ctx context.Context, r ddns.Record) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, exist := p.records[r.Handle.(int)]; !exist {
+		return fmt.Errorf("record %d not found", r.Handle)
+	}
+
+	delete(p.records, r.Handle.(int))
+	return nil
+}
+
+func (p *fakeProvider) ListRecords(ctx context.Context, markPrefix string) (records []ddns.Record, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, record := range p.records {
+		if strings.HasPrefix(record.Mark, markPrefix) {
+			records = append(records, record)
+		}
+	}
+
+	return records, nil
+}
+
+func (p *fakeProvider) DecodeHandle(data []byte) (any, error) {
+	var id int
+	err := json.Unmarshal(data, &id)
+	return id, err
+}
+
+func (p *fakeProvider) Options(o ddns.RecordOptions) (ddns.RecordOptions, error) {
+	if o.TTL == 0 {
+		o.TTL = 60
+	}
+
+	return o, nil
+}
+
+// contents returns sorted addresses of all records.
+func (p *fakeProvider) contents() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var contents []string
+	for _, record := range p.records {
+		contents = append(contents, record.Address)
+	}
+
+	slices.Sort(contents)
+	return contents
+}
+
+// add puts records into provider directly, like changes made by others.
+func (p *fakeProvider) add(records ...ddns.Record) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, record := range records {
+		p.nextID++
+		record.Handle = p.nextID
+		p.records[p.nextID] = record
+	}
+}
+
+// marks returns sorted "domain mark" of all records.
+func (p *fakeProvider) marks() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var marks []string
+	for _, record := range p.records {
+		marks = append(marks, record.Domain+" "+record.Mark)
+	}
+
+	slices.Sort(marks)
+	return marks
+}
+
+// setServiceName sets service name for the test.
+func setServiceName(t *testing.T, name string) {
+	mark, legacy, service := DefaultMark, legacyMark, serviceName
+	t.Cleanup(func() { DefaultMark, legacyMark, serviceName = mark, legacy, service })
+
+	if err := SetServiceName(name); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func ips(strs ...string) []net.IP {
+	var result []net.IP
+	for _, s := range strs {
+		result = append(result, net.ParseIP(s))
+	}
+
+	return result
+}
+
+// Restarts with state make no lookups. Restored records are trusted until writing them fails, or
+// drift check finds them changed outside.
+func TestPublishRestoredRecords(t *testing.T) {
+	ctx := context.Background()
+	provider, pc := newFakeProvider(t)
+	dc := []config.Domain{
+		{Domain: "a.example.com", Type: "A", Address: "x"},
+		{Domain: "b.example.com", Type: "A", Address: "x"},
+	}
+
+	p, err := NewPublisher(ctx, pc, dc, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.Publish(ctx, map[string][]net.IP{"x": ips("192.0.2.1")}); err != nil {
+		t.Fatal(err)
+	}
+
+	st := &State{}
+	if err := st.Update(&Resolver{}, p); err != nil {
+		t.Fatal(err)
+	}
+
+	provider.finds = 0
+	p, err = NewPublisher(ctx, pc, dc, nil, st)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p.CheckDrift = true
+	p.DriftInterval = time.Hour
+
+	steps := []struct {
+		name   string
+		change func(r ddns.Record) (ddns.Record, bool)
+		drift  bool
+		ip     string
+		finds  int
+		want   []string
+	}{
+		{name: "unchanged", ip: "192.0.2.1", finds: 0, want: []string{"192.0.2.1", "192.0.2.1"}},
+		{name: "changed", ip: "192.0.2.2", finds: 0, want: []string{"192.0.2.2", "192.0.2.2"}},
+		{
+			name:   "deleted outside",
+			change: func(r ddns.Record) (ddns.Record, bool) { return r, false },
+			ip:     "192.0.2.3",
+			finds:  2,
+			want:   []string{"192.0.2.3", "192.0.2.3"},
+		},
+		{
+			name:   "edited outside",
+			change: func(r ddns.Record) (ddns.Record, bool) { r.Address = "192.0.2.9"; return r, true },
+			ip:     "192.0.2.3",
+			finds:  2,
+			want:   []string{"192.0.2.9", "192.0.2.9"},
+		},
+		{
+			name:  "drift check due",
+			drift: true,
+			ip:    "192.0.2.3",
+			finds: 4,
+			want:  []string{"192.0.2.3", "192.0.2.3"},
+		},
+	}
+
+	for _, step := range steps {
+		if step.change != nil {
+			provider.mu.Lock()
+			for id, record := range provider.records {
+				if record, keep := step.change(record); keep {
+					provider.records[id] = record
+				} else {
+					delete(provider.records, id)
+				}
+			}
+			provider.mu.Unlock()
+		}
+
+		if step.drift {
+			p.DriftInterval = 0
+		}
+
+		if err := p.Publish(ctx, map[string][]net.IP{"x": ips(step.ip)}); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+
+		if got := provider.contents(); !slices.Equal(got, step.want) {
+			t.Errorf("%s: records = %v, want %v", step.name, got, step.want)
+		}
+
+		if provider.finds != step.finds {
+			t.Errorf("%s: finds = %d, want %d", step.name, provider.finds, step.finds)
+		}
+	}
+}
+
+func TestPublishOptionsDrift(t *testing.T) {
+	tests := []struct {
+		name  string
+		tags  []string
+		drift func(r *ddns.Record)
+		ip    string
+		want  ddns.RecordOptions
+	}{
+		{
+			name:  "ttl changed outside",
+			drift: func(r *ddns.Record) { r.Options.TTL = 300 },
+			ip:    "192.0.2.1",
+			want:  ddns.RecordOptions{TTL: 60},
+		},
+		{
+			name:  "unmanaged tags kept on update",
+			drift: func(r *ddns.Record) { r.Options.Tags = []string{"manual:1"} },
+			ip:    "192.0.2.2",
+			want:  ddns.RecordOptions{TTL: 60, Tags: []string{"manual:1"}},
+		},
+		{
+			name:  "managed tags corrected",
+			tags:  []string{"owner:ddns"},
+			drift: func(r *ddns.Record) { r.Options.Tags = []string{"manual:1"} },
+			ip:    "192.0.2.1",
+			want:  ddns.RecordOptions{TTL: 60, Tags: []string{"owner:ddns"}},
+		},
+		{
+			name:  "managed empty tags clear",
+			tags:  []string{},
+			drift: func(r *ddns.Record) { r.Options.Tags = []string{"manual:1"} },
+			ip:    "192.0.2.1",
+			want:  ddns.RecordOptions{TTL: 60, Tags: []string{}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			provider, pc := newFakeProvider(t)
+			dc := []config.Domain{{Domain: "a.example.com", Type: "A", Address: "x", Tags: tt.tags}}
+
+			p, err := NewPublisher(ctx, pc, dc, nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			p.CheckDrift = true
+			if err := p.Publish(ctx, map[string][]net.IP{"x": ips("192.0.2.1")}); err != nil {
+				t.Fatal(err)
+			}
+
+			provider.mu.Lock()
+			for id, record := range provider.records {
+				tt.drift(&record)
+				provider.records[id] = record
+			}
+			provider.mu.Unlock()
+
+			if err := p.Publish(ctx, map[string][]net.IP{"x": ips(tt.ip)}); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, record := range provider.records {
+				if !record.Options.Matches(tt.want) {
+					t.Errorf("options = %+v, want %+v", record.Options, tt.want)
+				}
+			}
+		})
+	}
+}
+
+// Domains of addresses resolved are published when others failed, and records of failed ones are
+// kept as is.
+func TestPublishPartialState(t *testing.T) {
+	ctx := context.Background()
+	provider, pc := newFakeProvider(t)
+	dc := []config.Domain{
+		{Domain: "a.example.com", Type: "A", Address: "x"},
+		{Domain: "b.example.com", Type: "A", Address: "y"},
+	}
+
+	p, err := NewPublisher(ctx, pc, dc, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.Publish(ctx, map[string][]net.IP{"x": ips("192.0.2.1"), "y": ips("192.0.2.2")}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.Publish(ctx, map[string][]net.IP{"x": ips("192.0.2.3")}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := provider.contents(); !slices.Equal(got, []string{"192.0.2.2", "192.0.2.3"}) {
+		t.Errorf("records = %v, want [192.0.2.2 192.0.2.3]", got)
+	}
+}
+
+// Within min interval, missing records are created while changes of existing ones are deferred.
+func TestPublishMinInterval(t *testing.T) {
+	ctx := context.Background()
+	provider, pc := newFakeProvider(t)
+	dc := []config.Domain{{Domain: "a.example.com", Type: "A", Address: "x", MinInterval: common.Duration(time.Hour)}}
+
+	p, err := NewPublisher(ctx, pc, dc, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		ips  []net.IP
+		want []string
+	}{
+		{ips: ips("192.0.2.1"), want: []string{"192.0.2.1"}},
+		{ips: ips("192.0.2.1", "192.0.2.2"), want: []string{"192.0.2.1", "192.0.2.2"}},
+		{ips: ips("192.0.2.3"), want: []string{"192.0.2.1", "192.0.2.2"}},
+		{ips: ips("192.0.2.2", "192.0.2.4"), want: []string{"192.0.2.1", "192.0.2.2"}},
+	}
+
+	for i, step := range steps {
+		if err := p.Publish(ctx, map[string][]net.IP{"x": step.ips}); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := provider.contents(); !slices.Equal(got, step.want) {
+			t.Errorf("step %d: records = %v, want %v", i, got, step.want)
+		}
+	}
+}
+
+// Only records marked by exactly this instance are collected, not those of instances named alike.
+func TestCollectGarbage(t *testing.T) {
+	ctx := context.Background()
+	setServiceName(t, "home")
+	provider, pc := newFakeProvider(t)
+	provider.add(
+		ddns.Record{Domain: "a.example.com", Type: "A", Address: "192.0.2.1", Mark: "cfddns@home/x"},
+		ddns.Record{Domain: "b.example.com", Type: "A", Address: "192.0.2.1", Mark: "cfddns@home"},
+		ddns.Record{Domain: "b.example.com", Type: "A", Address: "192.0.2.1", Mark: "cfddns@home/y"},
+		ddns.Record{Domain: "b.example.com", Type: "A", Address: "192.0.2.1", Mark: "cfddns@home-lab"},
+		ddns.Record{Domain: "b.example.com", Type: "A", Address: "192.0.2.1", Mark: "cfddns@home-lab/x"},
+		ddns.Record{Domain: "b.example.com", Type: "A", Address: "192.0.2.1", Mark: "cfddns-home-lab"},
+	)
+
+	mark := "x"
+	dc := []config.Domain{{Domain: "a.example.com", Type: "A", Address: "x", Mark: &mark}}
+	p, err := NewPublisher(ctx, pc, dc, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	orphans, err := p.CollectGarbage(ctx, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(orphans) != 2 {
+		t.Errorf("orphans = %+v, want 2", orphans)
+	}
+
+	want := []string{
+		"a.example.com cfddns@home/x",
+		"b.example.com cfddns-home-lab",
+		"b.example.com cfddns@home-lab",
+		"b.example.com cfddns@home-lab/x",
+	}
+	if got := provider.marks(); !slices.Equal(got, want) {
+		t.Errorf("records = %v, want %v", got, want)
+	}
+}
+
+func TestCollectGarbageWithoutServiceName(t *testing.T) {
+	ctx := context.Background()
+	setServiceName(t, "")
+	provider, pc := newFakeProvider(t)
+	provider.add(ddns.Record{Domain: "b.example.com", Type: "A", Address: "192.0.2.1", Mark: "cfddns@home"})
+
+	p, err := NewPublisher(ctx, pc, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := p.CollectGarbage(ctx, false); err == nil {
+		t.Error("want error")
+	}
+
+	if got := provider.contents(); len(got) != 1 {
+		t.Errorf("records = %v, want kept", got)
+	}
+}
+
+// Records marked by older versions are taken over instead of duplicated.
+func TestPublishLegacyMark(t *testing.T) {
+	ctx := context.Background()
+	setServiceName(t, "home")
+	provider, pc := newFakeProvider(t)
+	provider.add(ddns.Record{Domain: "a.example.com", Type: "A", Address: "192.0.2.1", Mark: "cfddns-home-x", Options: ddns.RecordOptions{TTL: 60}})
+
+	mark := "x"
+	dc := []config.Domain{{Domain: "a.example.com", Type: "A", Address: "x", Mark: &mark}}
+	p, err := NewPublisher(ctx, pc, dc, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.Publish(ctx, map[string][]net.IP{"x": ips("192.0.2.2")}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := provider.marks(), []string{"a.example.com cfddns@home/x"}; !slices.Equal(got, want) {
+		t.Errorf("records = %v, want %v", got, want)
+	}
+
+	if got := provider.contents(); !slices.Equal(got, []string{"192.0.2.2"}) {
+		t.Errorf("records = %v, want [192.0.2.2]", got)
+	}
+}
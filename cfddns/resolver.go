@@ -4,59 +4,473 @@ import (
 	"cfddns/common"
 	"cfddns/config"
 	"cfddns/log"
+	"cfddns/metrics"
+	"cfddns/notify"
 	"cfddns/sources"
 	"cfddns/transformers"
 	"context"
+	"errors"
 	"fmt"
 	"go.uber.org/zap"
 	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 )
 
 type ipResolver struct {
+	name         string
 	sources      []sources.Interface
+	breakers     []*breaker
 	transformers []transformers.Interface
+	strategy     common.ResolveStrategy
+	quorum       int
+	stability    config.Stability
+
+	// candidate is the changed IP set not yet stable, and count is times it's observed in a row.
+	candidate []net.IP
+	count     int
+
+	statusMu sync.Mutex
+	status   AddressStatus
+	restored bool
 }
 
-func (r *ipResolver) resolve(ctx context.Context) (ip net.IP, err error) {
-	sourceType := ""
-Next:
-	for _, source := range r.sources {
-		ip, err = source.Lookup(ctx)
-		if err != nil {
-			continue
+func (r *ipResolver) lookup(ctx context.Context, source sources.Interface) (ips []net.IP, err error) {
+	start := time.Now()
+	if multi, ok := source.(sources.MultiSource); ok {
+		ips, err = multi.LookupAll(ctx)
+	} else {
+		var ip net.IP
+		if ip, err = source.Lookup(ctx); err == nil {
+			ips = []net.IP{ip}
 		}
+	}
+
+	metrics.SourceLookups.WithLabelValues(r.name, source.Typename()).Inc()
+	metrics.SourceLookupDuration.WithLabelValues(r.name, source.Typename()).Observe(time.Since(start).Seconds())
+	// Lookups canceled because of racing are not failures of the source.
+	if err != nil && ctx.Err() == nil {
+		metrics.SourceLookupFailures.WithLabelValues(r.name, source.Typename()).Inc()
+	}
 
+	return ips, err
+}
+
+// try gets IP from the i-th source and applies all transformers on each of them.
+func (r *ipResolver) try(ctx context.Context, i int) (ips []net.IP, failure *SourceFailure) {
+	source := r.sources[i]
+
+	ips, err := r.lookup(ctx, source)
+	if err != nil {
+		if ctx.Err() == nil {
+			r.breakers[i].failed(r.sourceContext(ctx, i))
+		}
+
+		return nil, &SourceFailure{Index: i, Type: source.Typename(), Error: err.Error()}
+	}
+
+	r.breakers[i].succeeded(r.sourceContext(ctx, i))
+
+	result := make([]net.IP, 0, len(ips))
+	for _, ip := range ips {
 		for _, transformer := range r.transformers {
 			ip, err = transformer.Transform(ctx, ip)
 			if err != nil {
-				continue Next
+				return nil, &SourceFailure{Index: i, Type: source.Typename(), Error: "transform: " + err.Error()}
 			}
 		}
 
-		sourceType = source.Typename()
-		break
+		// Transformers may map different IP to the same one.
+		if !slices.ContainsFunc(result, ip.Equal) {
+			result = append(result, ip)
+		}
+	}
+
+	return result, nil
+}
+
+func (r *ipResolver) sourceContext(ctx context.Context, i int) context.Context {
+	return log.SWith(ctx, "source_index", i, "source_type", r.sources[i].Typename())
+}
+
+// order returns indexes of sources to query, with available ones first, followed by those
+// demoted by their breakers.
+func (r *ipResolver) order(ctx context.Context) (available []int, demoted []int) {
+	for i := range r.sources {
+		if r.breakers[i].available(r.sourceContext(ctx, i)) {
+			available = append(available, i)
+		} else {
+			demoted = append(demoted, i)
+		}
+	}
+
+	return available, demoted
+}
+
+// ipSetKey returns a string identifying ips regardless of order.
+func ipSetKey(ips []net.IP) string {
+	keys := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		keys = append(keys, ip.String())
+	}
+
+	slices.Sort(keys)
+	return strings.Join(keys, ",")
+}
+
+type sourceResult struct {
+	index   int
+	ips     []net.IP
+	failure *SourceFailure
+}
+
+// tryAll queries all available sources concurrently, and demoted ones as well if less than need
+// sources are available. Results are sent to the returned channel as they come, the count of which
+// is returned.
+func (r *ipResolver) tryAll(ctx context.Context, need int) (<-chan sourceResult, int) {
+	indexes, demoted := r.order(ctx)
+	if len(indexes) < need && len(demoted) != 0 {
+		log.S(ctx).Warnw("not enough available sources, trying demoted ones anyway", "available", len(indexes), "need", need)
+		indexes = append(indexes, demoted...)
+	}
+
+	results := make(chan sourceResult, len(indexes))
+	for _, i := range indexes {
+		go func() {
+			ips, failure := r.try(ctx, i)
+			results <- sourceResult{index: i, ips: ips, failure: failure}
+		}()
+	}
+
+	return results, len(indexes)
+}
+
+func (r *ipResolver) resolveFirst(ctx context.Context) (ips []net.IP, index int, failures []SourceFailure, err error) {
+	available, demoted := r.order(ctx)
+	for _, i := range append(available, demoted...) {
+		ips, failure := r.try(ctx, i)
+		if failure != nil {
+			failures = append(failures, *failure)
+			continue
+		}
+
+		return ips, i, failures, nil
 	}
 
-	if ip == nil {
-		log.S(ctx).Errorw("all source failed, unable to get ip")
-		return nil, fmt.Errorf("all source failed")
+	return nil, 0, failures, fmt.Errorf("all source failed")
+}
+
+func (r *ipResolver) resolveRace(ctx context.Context) (ips []net.IP, index int, failures []SourceFailure, err error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results, count := r.tryAll(ctx, 1)
+	for range count {
+		result := <-results
+		if result.failure != nil {
+			failures = append(failures, *result.failure)
+			continue
+		}
+
+		return result.ips, result.index, failures, nil
 	}
 
-	log.S(ctx).Infow("resolved ip", "ip", ip, "source_type", sourceType)
+	return nil, 0, failures, fmt.Errorf("all source failed")
+}
+
+func (r *ipResolver) resolveQuorum(ctx context.Context) (ips []net.IP, index int, failures []SourceFailure, err error) {
+	// Default quorum is majority of all sources. Sources demoted by breakers still count, so the
+	// few left available can't decide alone.
+	quorum := r.quorum
+	if quorum == 0 {
+		quorum = len(r.sources)/2 + 1
+	}
+
+	votes := map[string][]int{}
+	sets := map[string][]net.IP{}
+	results, count := r.tryAll(ctx, quorum)
+	if count < quorum {
+		return nil, 0, nil, fmt.Errorf("no quorum: only %d source can answer, %d required", count, quorum)
+	}
+
+	for range count {
+		result := <-results
+		if result.failure != nil {
+			failures = append(failures, *result.failure)
+			continue
+		}
+
+		// Sources vote for the whole set of IP.
+		key := ipSetKey(result.ips)
+		votes[key] = append(votes[key], result.index)
+		sets[key] = result.ips
+	}
+
+	if len(votes) == 0 {
+		return nil, 0, failures, fmt.Errorf("all source failed")
+	}
+
+	if len(votes) > 1 {
+		log.S(ctx).Warnw("sources disagree on ip", "votes", votes)
+	}
+
+	// Most voted wins. On tie, the one reported by the earliest source wins.
+	best := ""
+	for key, indexes := range votes {
+		if best == "" || len(indexes) > len(votes[best]) ||
+			len(indexes) == len(votes[best]) && slices.Min(indexes) < slices.Min(votes[best]) {
+			best = key
+		}
+	}
+
+	if len(votes[best]) < quorum {
+		return nil, 0, failures, fmt.Errorf("no quorum: at most %d source agreed, %d required", len(votes[best]), quorum)
+	}
+
+	return sets[best], slices.Min(votes[best]), failures, nil
+}
+
+func (r *ipResolver) resolveMerge(ctx context.Context) (ips []net.IP, index int, failures []SourceFailure, err error) {
+	results := make([]*sourceResult, len(r.sources))
+	resultsChan, count := r.tryAll(ctx, 1)
+	for range count {
+		result := <-resultsChan
+		if result.failure != nil {
+			failures = append(failures, *result.failure)
+			continue
+		}
+
+		results[result.index] = &result
+	}
+
+	// Merge in source order, so the result is stable.
+	index = -1
+	for i, result := range results {
+		if result == nil {
+			continue
+		}
+
+		if index == -1 {
+			index = i
+		}
+
+		for _, ip := range result.ips {
+			if !slices.ContainsFunc(ips, ip.Equal) {
+				ips = append(ips, ip)
+			}
+		}
+	}
+
+	if index == -1 {
+		return nil, 0, failures, fmt.Errorf("all source failed")
+	}
+
+	return ips, index, failures, nil
+}
+
+func (r *ipResolver) resolve(ctx context.Context, notifier *notify.Notifier) (ips []net.IP, err error) {
+	var index int
+	var failures []SourceFailure
+	switch r.strategy {
+	case common.StrategyRace:
+		ips, index, failures, err = r.resolveRace(ctx)
+	case common.StrategyQuorum:
+		ips, index, failures, err = r.resolveQuorum(ctx)
+	case common.StrategyMerge:
+		ips, index, failures, err = r.resolveMerge(ctx)
+	default:
+		ips, index, failures, err = r.resolveFirst(ctx)
+	}
+
+	// Canceled, e.g. by racing of a referencing address, or shutdown. It says nothing about this
+	// address, so neither status nor notifier is told.
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	if err == nil && len(ips) == 0 {
+		err = fmt.Errorf("no ip resolved")
+	}
+
+	slices.SortFunc(failures, func(a, b SourceFailure) int {
+		return a.Index - b.Index
+	})
+
+	r.statusMu.Lock()
+	defer r.statusMu.Unlock()
+
+	now := time.Now()
+	r.status.CheckedAt = &now
+	r.status.Failures = failures
+
+	if err != nil {
+		log.S(ctx).Errorw("unable to get ip", "strategy", r.strategy, zap.Error(err))
+		r.status.Error = err.Error()
+		notifier.Failed(ctx, common.EventResolveFailed, fmt.Sprintf("address %q", r.name), err)
+		return nil, err
+	}
+
+	notifier.Succeeded(ctx, fmt.Sprintf("address %q", r.name))
+
+	sourceType := r.sources[index].Typename()
+	log.S(ctx).Infow("resolved ip", log.IPs(ips), "source_type", sourceType)
+
+	ips = r.stabilize(ctx, ips, now)
+
+	strs := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		strs = append(strs, ip.String())
+	}
+
+	if ipSetKey(ips) != stringSetKey(r.status.IPs) {
+		if r.restored {
+			log.S(ctx).Infow("ip changed since last run", log.IPs(ips), "old_ips", r.status.IPs, "old_changed_at", r.status.ChangedAt)
+		}
+
+		// First resolve without state is not a change.
+		if len(r.status.IPs) != 0 {
+			notifier.IPChanged(ctx, r.name, r.status.IPs, strs)
+		}
+
+		r.status.ChangedAt = &now
+	}
+
+	r.restored = false
+	r.status.IPs = strs
+	r.status.Source = sourceType
+	r.status.SourceIndex = index
+	r.status.ResolvedAt = &now
+	r.status.Error = ""
 
 	return
 }
 
+// stringSetKey is ipSetKey of IP in strings.
+func stringSetKey(ips []string) string {
+	return strings.Join(slices.Sorted(slices.Values(ips)), ",")
+}
+
+// stabilize returns ips if they are the same as last resolved, or have been observed for configured
+// cycles and duration in a row. Otherwise ips are held as candidate, and last resolved IPs are
+// returned. It must be called with statusMu held.
+func (r *ipResolver) stabilize(ctx context.Context, ips []net.IP, now time.Time) []net.IP {
+	// Nothing to keep before first resolve.
+	if len(r.status.IPs) == 0 || ipSetKey(ips) == stringSetKey(r.status.IPs) {
+		if r.candidate != nil {
+			log.S(ctx).Infow("pending ip change dropped", zap.Stringers("candidate", r.candidate), "observations", r.count)
+		}
+
+		r.candidate, r.count = nil, 0
+		r.status.Pending, r.status.PendingSince = nil, nil
+		return ips
+	}
+
+	if r.candidate == nil || ipSetKey(ips) != ipSetKey(r.candidate) {
+		r.candidate, r.count = ips, 0
+		r.status.PendingSince = &now
+		r.status.Pending = make([]string, 0, len(ips))
+		for _, ip := range ips {
+			r.status.Pending = append(r.status.Pending, ip.String())
+		}
+	}
+
+	r.count++
+	since := *r.status.PendingSince
+	if r.count >= r.stability.Cycles && now.Sub(since) >= time.Duration(r.stability.Duration) {
+		r.candidate, r.count = nil, 0
+		r.status.Pending, r.status.PendingSince = nil, nil
+		return ips
+	}
+
+	log.S(ctx).Infow("ip change pending for stability", zap.Stringers("candidate", ips), "ips", r.status.IPs,
+		"observations", r.count, "since", since)
+
+	stable := make([]net.IP, 0, len(r.status.IPs))
+	for _, ip := range r.status.IPs {
+		stable = append(stable, net.ParseIP(ip))
+	}
+
+	return stable
+}
+
 type Resolver struct {
-	list map[string]ipResolver
+	// Notifier is told about address changes and failures, if set.
+	Notifier *notify.Notifier
+
+	list map[string]*ipResolver
+}
+
+// Restore loads last resolved IP of addresses from st.
+func (r Resolver) Restore(st *State) {
+	for name, addr := range st.Addresses {
+		res, exist := r.list[name]
+		if !exist {
+			continue
+		}
+
+		changedAt := addr.ChangedAt
+		res.statusMu.Lock()
+		res.status.IPs = addr.IPs
+		res.status.ChangedAt = &changedAt
+		res.restored = true
+		res.statusMu.Unlock()
+	}
+}
+
+// Status returns resolve state of all addresses, sorted by name.
+func (r Resolver) Status() (status []AddressStatus) {
+	status = make([]AddressStatus, 0, len(r.list))
+	for _, res := range r.list {
+		res.statusMu.Lock()
+		s := res.status
+		s.Name = res.name
+		res.statusMu.Unlock()
+
+		status = append(status, s)
+	}
+
+	slices.SortFunc(status, func(a, b AddressStatus) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return status
+}
+
+// resolveTable holds results of a single Resolve run. It's shared by concurrently queried sources.
+type resolveTable struct {
+	mu     sync.Mutex
+	result map[string][]net.IP
+	left   map[string]struct{}
+}
+
+// next returns an address not resolved yet.
+func (t *resolveTable) next() (name string, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for name = range t.left {
+		return name, true
+	}
+
+	return "", false
 }
 
-func (r Resolver) resolveOne(ctx context.Context, name string, table map[string]net.IP, left map[string]struct{}) (ip net.IP, err error) {
+func (r Resolver) resolveOne(ctx context.Context, name string, table *resolveTable) (ips []net.IP, err error) {
 	ctx = log.SWith(ctx, "name", name)
 
-	if ip_, exist := table[name]; exist {
+	table.mu.Lock()
+	ips_, exist := table.result[name]
+	table.mu.Unlock()
+
+	if exist {
 		log.S(ctx).Debugw("found result in resolved table")
-		return ip_, nil
+		if ips_ == nil {
+			return nil, fmt.Errorf("address failed to resolve")
+		}
+
+		return ips_, nil
 	}
 
 	res, exist := r.list[name]
@@ -65,77 +479,152 @@ func (r Resolver) resolveOne(ctx context.Context, name string, table map[string]
 		return nil, fmt.Errorf("non-exist IP address entry")
 	}
 
-	ip, err = res.resolve(ctx)
-	delete(left, name)
-	table[name] = ip
+	ips, err = res.resolve(ctx, r.Notifier)
+	if ctx.Err() != nil {
+		// Keep it left, to be resolved by others not canceled.
+		return nil, err
+	}
+
+	table.mu.Lock()
+	delete(table.left, name)
+	table.result[name] = ips
+	table.mu.Unlock()
+
+	metrics.SetAddress(name, ips)
 
 	return
 }
 
-func (r Resolver) Resolve(ctx context.Context) (result map[string]net.IP, err error) {
+// Resolve resolves all configured addresses. If some of them failed, an error is returned
+// along with the addresses that are successfully resolved.
+func (r Resolver) Resolve(ctx context.Context) (result map[string][]net.IP, err error) {
 	ctx = log.SWith(ctx, log.Stage("resolve"))
 
-	result = map[string]net.IP{}
-	left := map[string]struct{}{}
+	table := &resolveTable{result: map[string][]net.IP{}, left: map[string]struct{}{}}
 	for addr := range r.list {
-		left[addr] = struct{}{}
+		table.left[addr] = struct{}{}
 	}
 
-	ctx = context.WithValue(ctx, common.SourceResolverKey, func(ctx context.Context, name string) (net.IP, error) {
-		return r.resolveOne(ctx, name, result, left)
+	ctx = context.WithValue(ctx, common.SourceResolverKey, func(ctx context.Context, name string) ([]net.IP, error) {
+		return r.resolveOne(ctx, name, table)
 	})
 
-	for len(left) > 0 {
-		var name string
-		for n := range left {
-			name = n
+	for ctx.Err() == nil {
+		name, ok := table.next()
+		if !ok {
 			break
 		}
 
-		_, err = r.resolveOne(ctx, name, result, left)
-		if err != nil {
-			log.S(ctx).Errorw("resolve failed", "name", name, zap.Error(err))
-			return nil, err
+		if _, rErr := r.resolveOne(ctx, name, table); rErr != nil {
+			log.S(ctx).Errorw("resolve failed", "name", name, zap.Error(rErr))
+			err = errors.Join(err, fmt.Errorf("%s: %w", name, rErr))
+		}
+	}
+
+	if ctx.Err() != nil {
+		err = errors.Join(err, ctx.Err())
+	}
+
+	// Sources canceled by racing may still be writing to the table.
+	table.mu.Lock()
+	defer table.mu.Unlock()
+
+	result = map[string][]net.IP{}
+	for name, ips := range table.result {
+		if ips != nil {
+			result[name] = ips
 		}
 	}
 
 	return
 }
 
-func NewResolver(ctx context.Context, c []config.IPAddress) (*Resolver, error) {
-	r := &Resolver{list: map[string]ipResolver{}}
-
-	for _, addr := range c {
-		res := ipResolver{}
+// Watch starts watching all sources supporting it in background, and calls trigger when
+// any of them reports change.
+func (r Resolver) Watch(ctx context.Context, trigger func()) {
+	ctx = log.SWith(ctx, log.Stage("watch"))
 
-		for _, s := range addr.Sources {
-			ctx := log.SWith(ctx, log.Stage("init:source"), "name", addr.Name, "type", s.Type)
-			create, ok := sources.Sources[s.Type]
+	for name, res := range r.list {
+		for _, source := range res.sources {
+			watcher, ok := source.(sources.Watcher)
 			if !ok {
-				log.S(ctx).Errorw("unknown source type")
-				return nil, fmt.Errorf("unknown source type")
+				continue
 			}
 
-			if source, err := create(ctx, s); err != nil {
-				return nil, fmt.Errorf("failed creating source: %w", err)
-			} else {
-				res.sources = append(res.sources, source)
-			}
+			ctx := log.SWith(ctx, "name", name, "type", source.Typename())
+			go func() {
+				if err := watcher.Watch(ctx, trigger); err != nil {
+					log.S(ctx).Errorw("watch failed, changes will be found on next refresh", zap.Error(err))
+				}
+			}()
 		}
+	}
+}
 
-		for _, s := range addr.Transformers {
-			ctx := log.SWith(ctx, log.Stage("init:transformer"), "name", addr.Name, "type", s.Type)
-			create, ok := transformers.Transformers[s.Type]
-			if !ok {
-				log.S(ctx).Errorw("unknown transformer type")
-				return nil, fmt.Errorf("unknown transformer type")
-			}
+func newIPResolver(ctx context.Context, addr config.IPAddress) (res *ipResolver, err error) {
+	res = &ipResolver{name: addr.Name, strategy: addr.Strategy, quorum: addr.Quorum, stability: addr.Stability}
 
-			if transformer, err := create(ctx, s); err != nil {
-				return nil, fmt.Errorf("failed creating transformer: %w", err)
-			} else {
-				res.transformers = append(res.transformers, transformer)
-			}
+	if res.stability.Cycles < 0 || res.stability.Duration < 0 {
+		log.S(ctx).Errorw("bad stability", "name", addr.Name, "cycles", res.stability.Cycles, "duration", time.Duration(res.stability.Duration))
+		return res, fmt.Errorf("bad stability: cycles %d, duration %s", res.stability.Cycles, time.Duration(res.stability.Duration))
+	}
+
+	for _, s := range addr.Sources {
+		ctx := log.SWith(ctx, log.Stage("init:source"), "name", addr.Name, "type", s.Type)
+		create, ok := sources.Sources[s.Type]
+		if !ok {
+			log.S(ctx).Errorw("unknown source type")
+			return res, fmt.Errorf("unknown source type %q", s.Type)
+		}
+
+		if source, err := create(ctx, s); err != nil {
+			return res, fmt.Errorf("failed creating source: %w", err)
+		} else {
+			res.sources = append(res.sources, source)
+		}
+
+		// Every source has its own breaker, as they fail independently.
+		b, err := newBreaker(addr.Breaker)
+		if err != nil {
+			log.S(ctx).Errorw("bad breaker config", zap.Error(err))
+			return res, fmt.Errorf("bad breaker config: %w", err)
+		}
+
+		res.breakers = append(res.breakers, b)
+	}
+
+	for _, s := range addr.Transformers {
+		ctx := log.SWith(ctx, log.Stage("init:transformer"), "name", addr.Name, "type", s.Type)
+		create, ok := transformers.Transformers[s.Type]
+		if !ok {
+			log.S(ctx).Errorw("unknown transformer type")
+			return res, fmt.Errorf("unknown transformer type %q", s.Type)
+		}
+
+		if transformer, err := create(ctx, s); err != nil {
+			return res, fmt.Errorf("failed creating transformer: %w", err)
+		} else {
+			res.transformers = append(res.transformers, transformer)
+		}
+	}
+
+	if res.strategy == common.StrategyQuorum {
+		if res.quorum < 0 || res.quorum > len(res.sources) {
+			log.S(ctx).Errorw("bad quorum", "name", addr.Name, "quorum", res.quorum, "sources", len(res.sources))
+			return res, fmt.Errorf("quorum %d out of range of %d sources", res.quorum, len(res.sources))
+		}
+	}
+
+	return res, nil
+}
+
+func NewResolver(ctx context.Context, c []config.IPAddress) (*Resolver, error) {
+	r := &Resolver{list: map[string]*ipResolver{}}
+
+	for _, addr := range c {
+		res, err := newIPResolver(ctx, addr)
+		if err != nil {
+			return nil, err
 		}
 
 		r.list[addr.Name] = res
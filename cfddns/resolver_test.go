@@ -0,0 +1,152 @@
+package cfddns
+
+import (
+	"cfddns/common"
+	"cfddns/config"
+	"cfddns/sources"
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// fakeSource returns ip after delay, or fails if ip is empty.
+type fakeSource struct {
+	ip    string
+	delay time.Duration
+}
+
+func (s *fakeSource) Lookup(ctx context.Context) (net.IP, error) {
+	select {
+	case <-time.After(s.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	if s.ip == "" {
+		return nil, errors.New("fake failure")
+	}
+
+	return net.ParseIP(s.ip), nil
+}
+
+func (s *fakeSource) Typename() string {
+	return "fake"
+}
+
+func init() {
+	sources.Sources["fake"] = func(ctx context.Context, c config.IPSource) (sources.Interface, error) {
+		delay, _ := time.ParseDuration(c.Config["delay"].(string))
+		return &fakeSource{ip: c.Source, delay: delay}, nil
+	}
+}
+
+func fake(ip string, delay string) config.IPSource {
+	return config.IPSource{Type: "fake", Source: ip, Config: map[string]any{"delay": delay}}
+}
+
+// A reference source losing a race is canceled, which must not fail the referenced address.
+func TestResolveCanceledReference(t *testing.T) {
+	r, err := NewResolver(context.Background(), []config.IPAddress{
+		{Name: "slow", Sources: []config.IPSource{fake("192.0.2.2", "1h")}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	table := &resolveTable{result: map[string][]net.IP{}, left: map[string]struct{}{"slow": {}}}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	if _, err := r.resolveOne(ctx, "slow", table); err == nil {
+		t.Fatal("canceled resolve succeeded")
+	}
+
+	if _, exist := table.result["slow"]; exist {
+		t.Error("canceled result is cached")
+	}
+
+	if _, left := table.left["slow"]; !left {
+		t.Error("canceled address is no longer left")
+	}
+
+	if status := r.Status()[0]; status.Error != "" || status.CheckedAt != nil {
+		t.Errorf("canceled resolve recorded in status: %+v", status)
+	}
+}
+
+func TestResolveQuorum(t *testing.T) {
+	tests := []struct {
+		name    string
+		sources []config.IPSource
+		quorum  int
+		breaker config.Breaker
+		rounds  int
+		want    string
+	}{
+		{
+			name:    "majority agrees",
+			sources: []config.IPSource{fake("192.0.2.1", "0s"), fake("192.0.2.1", "0s"), fake("192.0.2.2", "0s")},
+			rounds:  1,
+			want:    "192.0.2.1",
+		},
+		{
+			name:    "no majority",
+			sources: []config.IPSource{fake("192.0.2.1", "0s"), fake("192.0.2.2", "0s"), fake("", "0s")},
+			rounds:  1,
+		},
+		{
+			// The source left after others are demoted by open breakers can't decide alone.
+			name:    "breakers open",
+			sources: []config.IPSource{fake("192.0.2.1", "0s"), fake("", "0s"), fake("", "0s")},
+			breaker: config.Breaker{Failures: 1, Cooldown: common.Duration(time.Hour)},
+			rounds:  2,
+		},
+		{
+			name:    "breakers open with majority",
+			sources: []config.IPSource{fake("192.0.2.1", "0s"), fake("192.0.2.1", "0s"), fake("", "0s")},
+			breaker: config.Breaker{Failures: 1, Cooldown: common.Duration(time.Hour)},
+			rounds:  2,
+			want:    "192.0.2.1",
+		},
+		{
+			// Explicit quorum is never lowered by demoted sources.
+			name:    "explicit quorum",
+			sources: []config.IPSource{fake("192.0.2.1", "0s"), fake("", "0s"), fake("", "0s")},
+			quorum:  2,
+			breaker: config.Breaker{Failures: 1, Cooldown: common.Duration(time.Hour)},
+			rounds:  2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			r, err := NewResolver(ctx, []config.IPAddress{{
+				Name:     "a",
+				Strategy: common.StrategyQuorum,
+				Quorum:   tt.quorum,
+				Sources:  tt.sources,
+				Breaker:  tt.breaker,
+			}})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var result map[string][]net.IP
+			for range tt.rounds {
+				result, _ = r.Resolve(ctx)
+			}
+
+			got := ""
+			if ips := result["a"]; len(ips) != 0 {
+				got = ips[0].String()
+			}
+
+			if got != tt.want {
+				t.Errorf("resolved %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package cfddns
+
+import (
+	"bytes"
+	"cfddns/ddns"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/goccy/go-json"
+)
+
+// State is the last known state persisted across restarts.
+type State struct {
+	Addresses map[string]AddressState `json:"addresses"`
+	Records   []RecordState           `json:"records"`
+
+	saved []byte
+}
+
+type AddressState struct {
+	IPs       []string  `json:"ips"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+type RecordState struct {
+	Provider  string             `json:"provider"`
+	Domain    string             `json:"domain"`
+	Type      string             `json:"type"`
+	Mark      string             `json:"mark"`
+	Content   string             `json:"content"`
+	Options   ddns.RecordOptions `json:"options"`
+	Handle    json.RawMessage    `json:"handle"`
+	UpdatedAt *time.Time         `json:"updated_at,omitempty"`
+}
+
+// LoadState reads state from path. An empty state is returned if path doesn't exist.
+func LoadState(path string) (*State, error) {
+	s := &State{Addresses: map[string]AddressState{}}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("bad state file: %w", err)
+	}
+
+	if s.Addresses == nil {
+		s.Addresses = map[string]AddressState{}
+	}
+
+	s.saved = data
+	return s, nil
+}
+
+// records returns all records in s having the given provider, domain, type and mark.
+func (s *State) records(provider, domain, nsType, mark string) (records []RecordState) {
+	for _, r := range s.Records {
+		if r.Provider == provider && r.Domain == domain && r.Type == nsType && r.Mark == mark {
+			records = append(records, r)
+		}
+	}
+
+	return records
+}
+
+// Update replaces content of s with current state of resolver and publisher.
+func (s *State) Update(resolver *Resolver, publisher *Publisher) error {
+	addresses := map[string]AddressState{}
+	for _, addr := range resolver.Status() {
+		if len(addr.IPs) != 0 && addr.ChangedAt != nil {
+			addresses[addr.Name] = AddressState{IPs: addr.IPs, ChangedAt: *addr.ChangedAt}
+		}
+	}
+
+	records, err := publisher.state()
+	if err != nil {
+		return err
+	}
+
+	s.Addresses = addresses
+	s.Records = records
+	return nil
+}
+
+// Save writes s to path, if it's changed since last load or save.
+func (s *State) Save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if bytes.Equal(data, s.saved) {
+		return nil
+	}
+
+	// Write to a temporary file first, so that a crash never leaves a broken state file.
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(f.Name(), path); err != nil {
+		return err
+	}
+
+	s.saved = data
+	return nil
+}
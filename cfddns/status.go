@@ -0,0 +1,88 @@
+package cfddns
+
+import (
+	"sync"
+	"time"
+)
+
+// SourceFailure describes a failed source in the last resolve of an address.
+type SourceFailure struct {
+	Index int    `json:"index"`
+	Type  string `json:"type"`
+	Error string `json:"error"`
+}
+
+// AddressStatus describes the resolve state of an address.
+type AddressStatus struct {
+	Name        string          `json:"name"`
+	IPs         []string        `json:"ips,omitempty"`
+	Source      string          `json:"source,omitempty"`
+	SourceIndex int             `json:"source_index"`
+	ResolvedAt  *time.Time      `json:"resolved_at,omitempty"`
+	ChangedAt   *time.Time      `json:"changed_at,omitempty"`
+	CheckedAt   *time.Time      `json:"checked_at,omitempty"`
+	Failures    []SourceFailure `json:"failures,omitempty"`
+	Error       string          `json:"error,omitempty"`
+	// Pending is a changed IP set waiting to be observed long enough to replace IPs.
+	Pending      []string   `json:"pending,omitempty"`
+	PendingSince *time.Time `json:"pending_since,omitempty"`
+}
+
+// DomainStatus describes the publish state of a record.
+type DomainStatus struct {
+	Provider  string     `json:"provider"`
+	Domain    string     `json:"domain"`
+	Type      string     `json:"type"`
+	Mark      string     `json:"mark"`
+	Address   string     `json:"address"`
+	Content   []string   `json:"content,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+	CheckedAt *time.Time `json:"checked_at,omitempty"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// Health records results of update cycles.
+type Health struct {
+	mu          sync.Mutex
+	lastRun     time.Time
+	lastSuccess time.Time
+	lastErr     error
+}
+
+type HealthStatus struct {
+	LastRun     *time.Time `json:"last_run,omitempty"`
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+}
+
+// Record records the result of an update cycle finished now.
+func (h *Health) Record(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.lastRun = time.Now()
+	h.lastErr = err
+	if err == nil {
+		h.lastSuccess = h.lastRun
+	}
+}
+
+func (h *Health) Status() (s HealthStatus) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// Copy times, as fields are changed by Record once lock is released.
+	if lastRun := h.lastRun; !lastRun.IsZero() {
+		s.LastRun = &lastRun
+	}
+
+	if lastSuccess := h.lastSuccess; !lastSuccess.IsZero() {
+		s.LastSuccess = &lastSuccess
+	}
+
+	if h.lastErr != nil {
+		s.LastError = h.lastErr.Error()
+	}
+
+	return s
+}
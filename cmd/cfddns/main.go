@@ -1,19 +1,25 @@
 package main
 
 import (
+	"cfddns/api"
 	"cfddns/cfddns"
+	"cfddns/common"
 	"cfddns/config"
 	"cfddns/log"
+	"cfddns/metrics"
+	"cfddns/notify"
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"github.com/goccy/go-json"
-	"github.com/pelletier/go-toml/v2"
 	flag "github.com/spf13/pflag"
 	"go.uber.org/zap"
 	"gopkg.in/yaml.v3"
@@ -22,19 +28,51 @@ import (
 var (
 	configPath = flag.StringP("config", "c", "config.toml", "path to config file")
 	debug      = flag.Bool("debug", false, "enable debug output")
+	dryRun     = flag.Bool("dry-run", false, "print planned record changes without writing, exit with 2 if there are changes")
+	format     = flag.String("format", "text", "output format of dry run: text / json")
 	help       = flag.BoolP("help", "h", false, "Print help message")
 )
 
 var buildDate string
 
+const (
+	defaultDebounce           = 2 * time.Second
+	defaultHealthyIntervals   = 3
+	defaultShutdownTimeout    = 10 * time.Second
+	defaultDriftCheckInterval = time.Hour
+)
+
 var conf config.Config
 
 func init() {
+	flag.Usage = func() {
+		fmt.Println("Usage: cfddns [check] [flags]")
+		fmt.Println()
+		fmt.Println("Commands:")
+		fmt.Println("  check    validate config file without accessing network")
+		fmt.Println()
+		fmt.Println("Flags:")
+		fmt.Println(flag.CommandLine.FlagUsages())
+	}
+
 	flag.Parse()
 	if *help {
-		fmt.Println(flag.CommandLine.FlagUsages())
+		flag.Usage()
 		os.Exit(0)
 	}
+
+	switch flag.Arg(0) {
+	case "", "check":
+	default:
+		fmt.Printf("Unknown command: %s\n", flag.Arg(0))
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if *format != "text" && *format != "json" {
+		fmt.Printf("Unknown output format: %s\n", *format)
+		os.Exit(1)
+	}
 }
 
 func getInitLogger() context.Context {
@@ -91,7 +129,8 @@ func getLogger(ctx context.Context) context.Context {
 	return log.WithLogger(context.Background(), logger)
 }
 
-func handlePidFile(ctx context.Context) {
+// handlePidFile writes pid file, and returns a function removing it.
+func handlePidFile(ctx context.Context) func() {
 	ctx = log.With(ctx, zap.String("pid_file", conf.Service.PidFile))
 
 	if pid, err := os.ReadFile(conf.Service.PidFile); err == nil {
@@ -105,97 +144,362 @@ func handlePidFile(ctx context.Context) {
 		log.S(ctx).Fatalw("cannot write pid file", zap.Error(err))
 	}
 
-	clean := func(pidFile string) {
-		err := os.Remove(pidFile)
-		if err != nil {
+	return func() {
+		if err := os.Remove(conf.Service.PidFile); err != nil {
 			log.S(ctx).Errorw("cannot remove pid file", zap.Error(err))
 		}
 	}
+}
 
-	defer clean(conf.Service.PidFile)
+// graceContext returns a context that is not canceled along with ctx, but after grace since ctx
+// is done. So work started before shutdown has a chance to finish.
+func graceContext(ctx context.Context, grace time.Duration) (context.Context, context.CancelFunc) {
+	graceCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(ctx, func() {
+		select {
+		case <-time.After(grace):
+			log.S(ctx).Warnw("shutdown timeout exceeded, canceling", "timeout", grace)
+			cancel()
+		case <-graceCtx.Done():
+		}
+	})
 
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt)
-	go func(sigChan <-chan os.Signal, pidFile string) {
-		<-sigChan
-		clean(pidFile)
-		os.Exit(0)
-	}(sigChan, conf.Service.PidFile)
+	return graceCtx, func() {
+		stop()
+		cancel()
+	}
 }
 
-func main() {
-	ctx := getInitLogger()
-
-	if buildDate != "" {
-		log.S(ctx).Infow("cfddns starting", "variant", "release", "build_date", buildDate)
-	} else {
-		log.S(ctx).Infow("cfddns starting", "variant", "debug")
+// waitTimeout calls wait and blocks until it returns, for at most timeout.
+func waitTimeout(ctx context.Context, what string, timeout time.Duration, wait func()) {
+	done := make(chan struct{})
+	go func() {
+		wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		log.S(ctx).Warnw("shutdown timeout exceeded, stop waiting", "waiting", what, "timeout", timeout)
 	}
+}
 
+func loadConfig() error {
 	f, err := os.Open(*configPath)
 	if err != nil {
-		log.S(ctx).Fatalw("failed loading config", zap.Error(err))
+		return err
 	}
 
+	defer f.Close()
+
 	switch {
 	case strings.HasSuffix(*configPath, ".toml"):
-		err = toml.NewDecoder(f).Decode(&conf)
+		return config.DecodeTOML(f, &conf)
 	case strings.HasSuffix(*configPath, ".yaml") || strings.HasSuffix(*configPath, ".yml"):
-		err = yaml.NewDecoder(f).Decode(&conf)
+		return yaml.NewDecoder(f).Decode(&conf)
 	case strings.HasSuffix(*configPath, ".json"):
-		err = json.NewDecoder(f).Decode(&conf)
+		return json.NewDecoder(f).Decode(&conf)
+	default:
+		return fmt.Errorf("unknown config format")
+	}
+}
+
+func runCheck(ctx context.Context) {
+	problems := cfddns.Check(ctx, conf)
+	for _, p := range problems {
+		fmt.Println(p)
 	}
 
+	if len(problems) != 0 {
+		fmt.Printf("%s: %d problem(s) found\n", *configPath, len(problems))
+		os.Exit(1)
+	}
+
+	fmt.Printf("%s: OK\n", *configPath)
+	os.Exit(0)
+}
+
+func printPlan(entries []cfddns.PlanEntry) error {
+	if *format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(entries)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, e := range entries {
+		var detail string
+		switch e.Action {
+		case cfddns.PlanCreate:
+			detail = e.NewIP
+		case cfddns.PlanUpdate:
+			detail = e.OldIP + " -> " + e.NewIP
+			if e.OldIP == e.NewIP {
+				detail = e.NewIP + " (options drifted)"
+			}
+		case cfddns.PlanUnchanged, cfddns.PlanDelete:
+			detail = e.OldIP
+		case cfddns.PlanSkip:
+			detail = fmt.Sprintf("address %q not resolved", e.Address)
+		}
+
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", e.Action, e.Provider, e.Domain, e.Type, e.Mark, detail)
+	}
+
+	return w.Flush()
+}
+
+func runDryRun(ctx context.Context, resolver *cfddns.Resolver, publisher *cfddns.Publisher) {
+	result, err := resolver.Resolve(ctx)
 	if err != nil {
+		log.S(ctx).Warnw("resolve partially failed", zap.Error(err))
+	}
+
+	entries := publisher.Plan(ctx, result)
+
+	if conf.Service.GarbageCollect != common.GCOff {
+		orphans, err := publisher.CollectGarbage(ctx, true)
+		if err != nil {
+			log.S(ctx).Errorw("garbage collect failed", zap.Error(err))
+		}
+
+		entries = append(entries, orphans...)
+	}
+
+	if err := printPlan(entries); err != nil {
+		log.S(ctx).Fatalw("failed printing plan", zap.Error(err))
+	}
+
+	for _, e := range entries {
+		if e.Changed() {
+			os.Exit(2)
+		}
+	}
+
+	os.Exit(0)
+}
+
+func saveState(ctx context.Context, state *cfddns.State, resolver *cfddns.Resolver, publisher *cfddns.Publisher) {
+	ctx = log.SWith(ctx, "state_file", conf.Service.StateFile)
+
+	if err := state.Update(resolver, publisher); err != nil {
+		log.S(ctx).Errorw("cannot update state", zap.Error(err))
+		return
+	}
+
+	if err := state.Save(conf.Service.StateFile); err != nil {
+		log.S(ctx).Errorw("cannot save state file", zap.Error(err))
+	}
+}
+
+func main() {
+	ctx := getInitLogger()
+
+	if buildDate != "" {
+		log.S(ctx).Infow("cfddns starting", "variant", "release", "build_date", buildDate)
+	} else {
+		log.S(ctx).Infow("cfddns starting", "variant", "debug")
+	}
+
+	if err := loadConfig(); err != nil {
 		log.S(ctx).Fatalw("failed loading config", zap.Error(err))
 	}
 
-	if conf.Service.Name != "" {
-		cfddns.DefaultMark += "-" + conf.Service.Name
+	if flag.Arg(0) == "check" {
+		runCheck(ctx)
+	}
+
+	if err := cfddns.SetServiceName(conf.Service.Name); err != nil {
+		log.S(ctx).Fatalw("bad service name", zap.Error(err))
 	}
 
 	ctx = getLogger(ctx)
 
+	// Canceling ctx stops everything, except an in-flight publish which is given shutdown timeout.
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTimeout := time.Duration(conf.Service.ShutdownTimeout)
+	if shutdownTimeout <= 0 {
+		shutdownTimeout = defaultShutdownTimeout
+	}
+
+	if conf.Metrics.Listen != "" {
+		path := conf.Metrics.Path
+		if path == "" {
+			path = "/metrics"
+		}
+
+		go func() {
+			_ = metrics.Serve(ctx, conf.Metrics.Listen, path)
+		}()
+	}
+
+	notifier, err := notify.New(ctx, conf.Notify, conf.Service.Name)
+	if err != nil {
+		log.S(ctx).Fatalw("cannot init notifier", zap.Error(err))
+	}
+
 	resolver, err := cfddns.NewResolver(ctx, conf.Address)
 	if err != nil {
 		log.S(ctx).Fatalw("cannot init resolver", zap.Error(err))
 	}
 
-	publisher, err := cfddns.NewPublisher(ctx, conf.Provider, conf.Domain)
+	var state *cfddns.State
+	if conf.Service.StateFile != "" {
+		if state, err = cfddns.LoadState(conf.Service.StateFile); err != nil {
+			log.S(ctx).Warnw("cannot load state file, starting without it", "state_file", conf.Service.StateFile, zap.Error(err))
+			state = &cfddns.State{}
+		} else {
+			resolver.Restore(state)
+		}
+	}
+
+	publisher, err := cfddns.NewPublisher(ctx, conf.Provider, conf.Domain, conf.Hook, state)
 	if err != nil {
 		log.S(ctx).Fatalw("cannot init publisher", zap.Error(err))
 	}
 
+	publisher.CheckDrift = conf.Service.DriftCheck
+	publisher.DriftInterval = time.Duration(conf.Service.DriftCheckInterval)
+	if publisher.DriftInterval <= 0 {
+		publisher.DriftInterval = defaultDriftCheckInterval
+	}
+
+	if *dryRun {
+		runDryRun(ctx, resolver, publisher)
+	}
+
+	resolver.Notifier = notifier
+	publisher.Notifier = notifier
+
+	if conf.Service.GarbageCollect != common.GCOff {
+		_, err := publisher.CollectGarbage(ctx, conf.Service.GarbageCollect == common.GCDryRun)
+		if err != nil {
+			log.S(ctx).Errorw("garbage collect failed", zap.Error(err))
+		}
+	}
+
 	var ticker *time.Ticker
 	if conf.Service.RefreshRate > 0 {
 		ticker = time.NewTicker(time.Duration(conf.Service.RefreshRate))
 	}
 
+	removePidFile := func() {}
 	if conf.Service.PidFile != "" {
 		if ticker == nil {
 			log.S(ctx).Warnw("pid file enabled for one shot mode.")
 		}
 
-		handlePidFile(ctx)
+		removePidFile = handlePidFile(ctx)
+	}
+
+	refresh := make(chan struct{}, 1)
+	trigger := func() {
+		select {
+		case refresh <- struct{}{}:
+		default:
+		}
+	}
+
+	if ticker != nil {
+		resolver.Watch(ctx, trigger)
+	}
+
+	health := &cfddns.Health{}
+	if conf.API.Listen != "" {
+		intervals := conf.API.HealthyIntervals
+		if intervals <= 0 {
+			intervals = defaultHealthyIntervals
+		}
+
+		server := &api.Server{
+			Resolver:      resolver,
+			Publisher:     publisher,
+			Health:        health,
+			Refresh:       trigger,
+			HealthyWithin: time.Duration(intervals) * time.Duration(conf.Service.RefreshRate),
+		}
+
+		go func() {
+			_ = server.Serve(ctx, conf.API.Listen)
+		}()
+	}
+
+	debounce := time.Duration(conf.Service.Debounce)
+	if debounce == 0 {
+		debounce = defaultDebounce
 	}
 
+Loop:
 	for {
 		result, err := resolver.Resolve(ctx)
-		if err != nil {
-			log.S(ctx).Errorw("resolve failed, skip update", zap.Error(err))
-			goto EndUpdate
+		if ctx.Err() != nil {
+			log.S(ctx).Infow("resolve interrupted by shutdown, skip update")
+			break
 		}
 
-		err = publisher.Publish(ctx, result)
+		// Addresses resolved are still published, domains of failed ones are skipped by publisher.
 		if err != nil {
-			log.S(ctx).Errorw("publish failed", zap.Error(err))
+			log.S(ctx).Errorw("resolve partially failed", zap.Error(err), "resolved", len(result))
 		}
 
-	EndUpdate:
-		if ticker == nil {
+		// Publish is not interrupted by shutdown at once, so records are not left half updated.
+		{
+			publishCtx, cancel := graceContext(ctx, shutdownTimeout)
+			pErr := publisher.Publish(publishCtx, result)
+			cancel()
+
+			if pErr != nil {
+				log.S(ctx).Errorw("publish failed", zap.Error(pErr))
+			}
+
+			err = errors.Join(err, pErr)
+		}
+
+		health.Record(err)
+		if state != nil {
+			saveState(ctx, state, resolver, publisher)
+		}
+
+		if ticker == nil || ctx.Err() != nil {
 			break
 		}
 
-		<-ticker.C
+		select {
+		case <-ctx.Done():
+			break Loop
+		case <-ticker.C:
+		case <-refresh:
+			// Changes usually come in bursts, wait for them to settle.
+			log.S(ctx).Infow("refresh triggered", "debounce", debounce)
+			select {
+			case <-ctx.Done():
+				break Loop
+			case <-time.After(debounce):
+			}
+
+			select {
+			case <-refresh:
+			default:
+			}
+			ticker.Reset(time.Duration(conf.Service.RefreshRate))
+		}
+	}
+
+	if ticker != nil {
+		ticker.Stop()
 	}
+
+	if ctx.Err() != nil {
+		log.S(ctx).Infow("shutting down", "timeout", shutdownTimeout)
+	}
+
+	waitTimeout(ctx, "hooks", shutdownTimeout, publisher.WaitHooks)
+	waitTimeout(ctx, "notifications", shutdownTimeout, notifier.Wait)
+	removePidFile()
+
+	log.S(ctx).Infow("cfddns stopped")
+	_ = log.L(ctx).Sync()
 }
@@ -46,6 +46,7 @@ const (
 	SelectFirst IPSelectMode = iota
 	SelectShortest
 	SelectLast
+	SelectAll
 )
 
 func (m *IPSelectMode) UnmarshalText(b []byte) error {
@@ -56,6 +57,8 @@ func (m *IPSelectMode) UnmarshalText(b []byte) error {
 		*m = SelectShortest
 	case "last":
 		*m = SelectLast
+	case "all":
+		*m = SelectAll
 	default:
 		return errors.New("invalid mode")
 	}
@@ -70,6 +73,8 @@ func (m IPSelectMode) String() string {
 		return "shortest"
 	case SelectLast:
 		return "last"
+	case SelectAll:
+		return "all"
 	default:
 		return fmt.Sprintf("unknown<%d>", int(m))
 	}
@@ -137,3 +142,122 @@ func (f IPFilterFlag) String() string {
 func (f IPFilterFlag) Match(l IPFilterFlag) bool {
 	return (f & l) != 0
 }
+
+type GCMode int
+
+const (
+	GCOff GCMode = iota
+	GCDryRun
+	GCOn
+)
+
+func (m *GCMode) UnmarshalText(b []byte) error {
+	switch strings.ToLower(string(b)) {
+	case "off", "false", "no":
+		*m = GCOff
+	case "dry-run", "dryrun", "report":
+		*m = GCDryRun
+	case "on", "true", "yes":
+		*m = GCOn
+	default:
+		return errors.New("invalid mode")
+	}
+	return nil
+}
+
+func (m GCMode) String() string {
+	switch m {
+	case GCOff:
+		return "off"
+	case GCDryRun:
+		return "dry-run"
+	case GCOn:
+		return "on"
+	default:
+		return fmt.Sprintf("unknown<%d>", int(m))
+	}
+}
+
+type ResolveStrategy int
+
+const (
+	StrategyFirst ResolveStrategy = iota
+	StrategyRace
+	StrategyQuorum
+	StrategyMerge
+)
+
+func (s *ResolveStrategy) UnmarshalText(b []byte) error {
+	switch strings.ToLower(string(b)) {
+	case "first":
+		*s = StrategyFirst
+	case "race":
+		*s = StrategyRace
+	case "quorum":
+		*s = StrategyQuorum
+	case "merge":
+		*s = StrategyMerge
+	default:
+		return errors.New("invalid strategy")
+	}
+	return nil
+}
+
+func (s ResolveStrategy) String() string {
+	switch s {
+	case StrategyFirst:
+		return "first"
+	case StrategyRace:
+		return "race"
+	case StrategyQuorum:
+		return "quorum"
+	case StrategyMerge:
+		return "merge"
+	default:
+		return fmt.Sprintf("unknown<%d>", int(s))
+	}
+}
+
+type NotifyEvent int
+
+const (
+	EventIPChanged NotifyEvent = iota
+	EventResolveFailed
+	EventPublishFailed
+	EventRecovered
+)
+
+func (e *NotifyEvent) UnmarshalText(b []byte) error {
+	switch strings.ToLower(string(b)) {
+	case "ip_changed":
+		*e = EventIPChanged
+	case "resolve_failed":
+		*e = EventResolveFailed
+	case "publish_failed":
+		*e = EventPublishFailed
+	case "recovered":
+		*e = EventRecovered
+	default:
+		return errors.New("invalid event")
+	}
+	return nil
+}
+
+func (e NotifyEvent) MarshalText() ([]byte, error) {
+	return []byte(e.String()), nil
+}
+
+func (e NotifyEvent) String() string {
+	switch e {
+	case EventIPChanged:
+		return "ip_changed"
+	case EventResolveFailed:
+		return "resolve_failed"
+	case EventPublishFailed:
+		return "publish_failed"
+	case EventRecovered:
+		return "recovered"
+	default:
+		return fmt.Sprintf("unknown<%d>", int(e))
+	}
+}
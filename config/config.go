@@ -7,17 +7,29 @@ import (
 )
 
 type Config struct {
-	Service  Service          `toml:"service" json:"service" yaml:"service"`
-	Log      Log              `toml:"log" json:"log" yaml:"log"`
-	Provider CloudflareConfig `toml:"provider" json:"provider" yaml:"provider"`
-	Address  []IPAddress      `toml:"address" json:"address" yaml:"address"`
-	Domain   []Domain         `toml:"domain" json:"domain" yaml:"domain"`
+	Service  Service     `toml:"service" json:"service" yaml:"service"`
+	Log      Log         `toml:"log" json:"log" yaml:"log"`
+	Metrics  Metrics     `toml:"metrics" json:"metrics" yaml:"metrics"`
+	API      API         `toml:"api" json:"api" yaml:"api"`
+	Provider Providers   `toml:"provider" json:"provider" yaml:"provider"`
+	Address  []IPAddress `toml:"address" json:"address" yaml:"address"`
+	Domain   []Domain    `toml:"domain" json:"domain" yaml:"domain"`
+	Hook     []Hook      `toml:"hook" json:"hook" yaml:"hook"`
+	Notify   Notify      `toml:"notify" json:"notify" yaml:"notify"`
 }
 
 type Service struct {
-	Name        string          `toml:"name" json:"name" yaml:"name"`
-	RefreshRate common.Duration `toml:"refresh_rate" json:"refresh_rate" yaml:"refresh_rate"`
-	PidFile     string          `toml:"pid_file" json:"pid_file" yaml:"pid_file"`
+	Name           string          `toml:"name" json:"name" yaml:"name"`
+	RefreshRate    common.Duration `toml:"refresh_rate" json:"refresh_rate" yaml:"refresh_rate"`
+	PidFile        string          `toml:"pid_file" json:"pid_file" yaml:"pid_file"`
+	GarbageCollect common.GCMode   `toml:"garbage_collect" json:"garbage_collect" yaml:"garbage_collect"`
+	Debounce       common.Duration `toml:"debounce" json:"debounce" yaml:"debounce"`
+	StateFile      string          `toml:"state_file" json:"state_file" yaml:"state_file"`
+	DriftCheck     bool            `toml:"drift_check" json:"drift_check" yaml:"drift_check"`
+
+	DriftCheckInterval common.Duration `toml:"drift_check_interval" json:"drift_check_interval" yaml:"drift_check_interval"`
+
+	ShutdownTimeout common.Duration `toml:"shutdown_timeout" json:"shutdown_timeout" yaml:"shutdown_timeout"`
 }
 
 type Log struct {
@@ -27,16 +39,72 @@ type Log struct {
 	ErrorPath *[]string      `toml:"error_path" json:"error_path" yaml:"error_path"`
 }
 
+type Metrics struct {
+	Listen string `toml:"listen" json:"listen" yaml:"listen"`
+	Path   string `toml:"path" json:"path" yaml:"path"`
+}
+
+type API struct {
+	Listen           string `toml:"listen" json:"listen" yaml:"listen"`
+	HealthyIntervals int    `toml:"healthy_intervals" json:"healthy_intervals" yaml:"healthy_intervals"`
+}
+
+type Provider struct {
+	Name   string         `toml:"name" json:"name" yaml:"name"`
+	Type   string         `toml:"type" json:"type" yaml:"type"`
+	Config map[string]any `toml:"config,omitempty" json:"config,omitempty" yaml:"config,omitempty"`
+	Retry  Retry          `toml:"retry,omitempty" json:"retry,omitempty" yaml:"retry,omitempty"`
+
+	// CloudflareConfig keeps cloudflare options set directly in provider section working.
+	CloudflareConfig `yaml:",inline"`
+}
+
+type Retry struct {
+	Attempts   int             `toml:"attempts,omitempty" json:"attempts,omitempty" yaml:"attempts,omitempty"`
+	Backoff    common.Duration `toml:"backoff,omitempty" json:"backoff,omitempty" yaml:"backoff,omitempty"`
+	MaxBackoff common.Duration `toml:"max_backoff,omitempty" json:"max_backoff,omitempty" yaml:"max_backoff,omitempty"`
+	Jitter     *float64        `toml:"jitter,omitempty" json:"jitter,omitempty" yaml:"jitter,omitempty"`
+}
+
 type CloudflareConfig struct {
-	APIToken  string   `toml:"api_token" json:"api_token" yaml:"api_token"`
-	ZoneNames []string `toml:"zone_names" json:"zone_names" yaml:"zone_names"`
-	TTL       int      `toml:"ttl" json:"ttl" yaml:"ttl"`
+	APIToken  string   `toml:"api_token" json:"api_token" yaml:"api_token" mapstructure:"api_token"`
+	ZoneNames []string `toml:"zone_names" json:"zone_names" yaml:"zone_names" mapstructure:"zone_names"`
+	TTL       int      `toml:"ttl" json:"ttl" yaml:"ttl" mapstructure:"ttl"`
+}
+
+type ProviderRFC2136Config struct {
+	Server        string          `mapstructure:"server"`
+	Network       string          `mapstructure:"network"`
+	ZoneNames     []string        `mapstructure:"zone_names"`
+	TTL           int             `mapstructure:"ttl"`
+	Timeout       common.Duration `mapstructure:"timeout"`
+	TSIGKey       string          `mapstructure:"tsig_key"`
+	TSIGSecret    string          `mapstructure:"tsig_secret"`
+	TSIGAlgorithm string          `mapstructure:"tsig_algorithm"`
+	MarkLabel     string          `mapstructure:"mark_label"`
 }
 
 type IPAddress struct {
 	Name         string          `toml:"name" json:"name" yaml:"name"`
 	Sources      []IPSource      `toml:"sources" json:"sources" yaml:"sources"`
 	Transformers []IPTransformer `toml:"transformers,omitempty" json:"transformers,omitempty" yaml:"transformers,omitempty"`
+
+	Strategy common.ResolveStrategy `toml:"strategy,omitempty" json:"strategy,omitempty" yaml:"strategy,omitempty"`
+	Quorum   int                    `toml:"quorum,omitempty" json:"quorum,omitempty" yaml:"quorum,omitempty"`
+	Breaker  Breaker                `toml:"breaker,omitempty" json:"breaker,omitempty" yaml:"breaker,omitempty"`
+
+	Stability Stability `toml:"stability,omitempty" json:"stability,omitempty" yaml:"stability,omitempty"`
+}
+
+type Stability struct {
+	Cycles   int             `toml:"cycles,omitempty" json:"cycles,omitempty" yaml:"cycles,omitempty"`
+	Duration common.Duration `toml:"duration,omitempty" json:"duration,omitempty" yaml:"duration,omitempty"`
+}
+
+type Breaker struct {
+	Failures    int             `toml:"failures,omitempty" json:"failures,omitempty" yaml:"failures,omitempty"`
+	Cooldown    common.Duration `toml:"cooldown,omitempty" json:"cooldown,omitempty" yaml:"cooldown,omitempty"`
+	MaxCooldown common.Duration `toml:"max_cooldown,omitempty" json:"max_cooldown,omitempty" yaml:"max_cooldown,omitempty"`
 }
 
 type IPSource struct {
@@ -46,8 +114,15 @@ type IPSource struct {
 }
 
 type IPSourceSimpleConfig struct {
-	Type    common.Family   `mapstructure:"type"`
-	Timeout common.Duration `mapstructure:"timeout"`
+	Type     common.Family     `mapstructure:"type"`
+	Timeout  common.Duration   `mapstructure:"timeout"`
+	Method   string            `mapstructure:"method"`
+	Headers  map[string]string `mapstructure:"headers"`
+	Body     string            `mapstructure:"body"`
+	Status   []int             `mapstructure:"status"`
+	MaxBody  int               `mapstructure:"max_body"`
+	JSONPath string            `mapstructure:"json_path"`
+	Regex    string            `mapstructure:"regex"`
 }
 
 type IPSourceCloudflareTraceConfig struct {
@@ -57,12 +132,61 @@ type IPSourceCloudflareTraceConfig struct {
 	IPHost       bool            `mapstructure:"ip_host"`
 }
 
+type IPSourceSTUNConfig struct {
+	Type    common.Family   `mapstructure:"type"`
+	Timeout common.Duration `mapstructure:"timeout"`
+	Servers []string        `mapstructure:"servers"`
+}
+
+type IPSourceGatewayConfig struct {
+	Timeout   common.Duration `mapstructure:"timeout"`
+	Protocols []string        `mapstructure:"protocols"`
+}
+
+type IPSourceExecConfig struct {
+	Type    common.Family     `mapstructure:"type"`
+	Timeout common.Duration   `mapstructure:"timeout"`
+	Args    []string          `mapstructure:"args"`
+	Env     map[string]string `mapstructure:"env"`
+	Dir     string            `mapstructure:"dir"`
+	Line    int               `mapstructure:"line"`
+	Regex   string            `mapstructure:"regex"`
+}
+
+type IPSourceFileConfig struct {
+	Type     common.Family `mapstructure:"type"`
+	Line     int           `mapstructure:"line"`
+	Key      string        `mapstructure:"key"`
+	JSONPath string        `mapstructure:"json_path"`
+	Regex    string        `mapstructure:"regex"`
+	Watch    bool          `mapstructure:"watch"`
+}
+
+type IPSourceRouteConfig struct {
+	Table     int    `mapstructure:"table"`
+	Mark      int    `mapstructure:"mark"`
+	Interface string `mapstructure:"interface"`
+}
+
+type IPSourceDNSConfig struct {
+	Type      *common.Family  `mapstructure:"type"`
+	Timeout   common.Duration `mapstructure:"timeout"`
+	Server    string          `mapstructure:"server"`
+	Port      int             `mapstructure:"port"`
+	Network   string          `mapstructure:"network"`
+	QueryType string          `mapstructure:"query_type"`
+	Class     string          `mapstructure:"class"`
+}
+
 type IPSourceInterfaceConfig struct {
 	Type    common.Family         `mapstructure:"type"`
 	Select  common.IPSelectMode   `mapstructure:"select"`
 	Flags   []common.IPFilterFlag `mapstructure:"flags"`
 	Exclude []common.CIDR         `mapstructure:"exclude"`
 	Include []common.CIDR         `mapstructure:"include"`
+	Watch   bool                  `mapstructure:"watch"`
+
+	InterfaceFlags []string `mapstructure:"interface_flags"`
 }
 
 type IPTransformer struct {
@@ -76,8 +200,76 @@ type IPTransformerMaskRewriteConfig struct {
 }
 
 type Domain struct {
-	Domain  string  `toml:"domain" json:"domain" yaml:"domain"`
-	Type    string  `toml:"type" json:"type" yaml:"type"`
-	Mark    *string `toml:"mark,omitempty" json:"mark,omitempty" yaml:"mark,omitempty"`
-	Address string  `toml:"address" json:"address" yaml:"address"`
+	Domain   string  `toml:"domain" json:"domain" yaml:"domain"`
+	Type     string  `toml:"type" json:"type" yaml:"type"`
+	Mark     *string `toml:"mark,omitempty" json:"mark,omitempty" yaml:"mark,omitempty"`
+	Address  string  `toml:"address" json:"address" yaml:"address"`
+	Provider string  `toml:"provider,omitempty" json:"provider,omitempty" yaml:"provider,omitempty"`
+
+	TTL     int      `toml:"ttl,omitempty" json:"ttl,omitempty" yaml:"ttl,omitempty"`
+	Proxied bool     `toml:"proxied,omitempty" json:"proxied,omitempty" yaml:"proxied,omitempty"`
+	Tags    []string `toml:"tags,omitempty" json:"tags,omitempty" yaml:"tags,omitempty"`
+
+	MinInterval common.Duration `toml:"min_interval,omitempty" json:"min_interval,omitempty" yaml:"min_interval,omitempty"`
+
+	Hooks []Hook `toml:"hooks,omitempty" json:"hooks,omitempty" yaml:"hooks,omitempty"`
+}
+
+type Hook struct {
+	Name       string          `toml:"name,omitempty" json:"name,omitempty" yaml:"name,omitempty"`
+	Type       string          `toml:"type" json:"type" yaml:"type"`
+	Target     string          `toml:"target" json:"target" yaml:"target"`
+	Timeout    common.Duration `toml:"timeout,omitempty" json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	Retry      int             `toml:"retry,omitempty" json:"retry,omitempty" yaml:"retry,omitempty"`
+	RetryDelay common.Duration `toml:"retry_delay,omitempty" json:"retry_delay,omitempty" yaml:"retry_delay,omitempty"`
+	Config     map[string]any  `toml:"config,omitempty" json:"config,omitempty" yaml:"config,omitempty"`
+}
+
+type Notify struct {
+	Failures   int             `toml:"failures" json:"failures" yaml:"failures"`
+	Dedup      common.Duration `toml:"dedup" json:"dedup" yaml:"dedup"`
+	RateLimit  int             `toml:"rate_limit" json:"rate_limit" yaml:"rate_limit"`
+	RateWindow common.Duration `toml:"rate_window" json:"rate_window" yaml:"rate_window"`
+	Channels   []NotifyChannel `toml:"channel" json:"channel" yaml:"channel"`
+}
+
+type NotifyChannel struct {
+	Name    string               `toml:"name,omitempty" json:"name,omitempty" yaml:"name,omitempty"`
+	Type    string               `toml:"type" json:"type" yaml:"type"`
+	Target  string               `toml:"target" json:"target" yaml:"target"`
+	Events  []common.NotifyEvent `toml:"events,omitempty" json:"events,omitempty" yaml:"events,omitempty"`
+	Timeout common.Duration      `toml:"timeout,omitempty" json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	Config  map[string]any       `toml:"config,omitempty" json:"config,omitempty" yaml:"config,omitempty"`
+}
+
+type NotifySMTPConfig struct {
+	From     string   `mapstructure:"from"`
+	To       []string `mapstructure:"to"`
+	Username string   `mapstructure:"username"`
+	Password string   `mapstructure:"password"`
+	TLS      string   `mapstructure:"tls"`
+}
+
+type NotifyPushConfig struct {
+	Token    string   `mapstructure:"token"`
+	Priority int      `mapstructure:"priority"`
+	Tags     []string `mapstructure:"tags"`
+}
+
+type NotifyWebhookConfig struct {
+	Method  string            `mapstructure:"method"`
+	Headers map[string]string `mapstructure:"headers"`
+	Body    string            `mapstructure:"body"`
+}
+
+type HookExecConfig struct {
+	Args []string          `mapstructure:"args"`
+	Env  map[string]string `mapstructure:"env"`
+	Dir  string            `mapstructure:"dir"`
+}
+
+type HookWebhookConfig struct {
+	Method  string            `mapstructure:"method"`
+	Headers map[string]string `mapstructure:"headers"`
+	Body    string            `mapstructure:"body"`
 }
@@ -0,0 +1,76 @@
+package config
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/goccy/go-json"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Providers is a list of providers. A single provider is also accepted, as config of old versions
+// has only one provider section.
+type Providers []Provider
+
+func (p *Providers) UnmarshalJSON(data []byte) error {
+	if data = bytes.TrimSpace(data); len(data) != 0 && data[0] == '{' {
+		var single Provider
+		if err := json.Unmarshal(data, &single); err != nil {
+			return err
+		}
+
+		*p = Providers{single}
+		return nil
+	}
+
+	return json.Unmarshal(data, (*[]Provider)(p))
+}
+
+func (p *Providers) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.MappingNode {
+		var single Provider
+		if err := node.Decode(&single); err != nil {
+			return err
+		}
+
+		*p = Providers{single}
+		return nil
+	}
+
+	return node.Decode((*[]Provider)(p))
+}
+
+// DecodeTOML decodes config from r. Both a single [provider] table of old versions, and
+// [[provider]] array of tables are accepted.
+//
+// It's done here instead of in Providers, as the TOML decoder doesn't call custom unmarshalers
+// for tables.
+func DecodeTOML(r io.Reader, c *Config) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	var probe map[string]any
+	if err := toml.Unmarshal(data, &probe); err != nil {
+		return err
+	}
+
+	if _, single := probe["provider"].(map[string]any); !single {
+		return toml.Unmarshal(data, c)
+	}
+
+	var legacy struct {
+		Config
+		Provider Provider `toml:"provider"`
+	}
+
+	if err := toml.Unmarshal(data, &legacy); err != nil {
+		return err
+	}
+
+	*c = legacy.Config
+	c.Provider = Providers{legacy.Provider}
+	return nil
+}
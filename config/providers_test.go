@@ -0,0 +1,92 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-json"
+	"gopkg.in/yaml.v3"
+)
+
+func TestProvidersForms(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		data   string
+		want   []string
+	}{
+		{
+			name:   "toml single table",
+			format: "toml",
+			data:   "[service]\nname = \"n\"\n[provider]\napi_token = \"a\"\nzone_names = [\"example.com\"]\n",
+			want:   []string{"a"},
+		},
+		{
+			name:   "toml array of tables",
+			format: "toml",
+			data:   "[service]\nname = \"n\"\n[[provider]]\napi_token = \"a\"\n[[provider]]\napi_token = \"b\"\n",
+			want:   []string{"a", "b"},
+		},
+		{
+			name:   "toml without provider",
+			format: "toml",
+			data:   "[service]\nname = \"n\"\n",
+		},
+		{
+			name:   "json object",
+			format: "json",
+			data:   `{"service": {"name": "n"}, "provider": {"api_token": "a"}}`,
+			want:   []string{"a"},
+		},
+		{
+			name:   "json array",
+			format: "json",
+			data:   `{"service": {"name": "n"}, "provider": [{"api_token": "a"}, {"api_token": "b"}]}`,
+			want:   []string{"a", "b"},
+		},
+		{
+			name:   "yaml mapping",
+			format: "yaml",
+			data:   "service:\n  name: n\nprovider:\n  api_token: a\n",
+			want:   []string{"a"},
+		},
+		{
+			name:   "yaml sequence",
+			format: "yaml",
+			data:   "service:\n  name: n\nprovider:\n  - api_token: a\n  - api_token: b\n",
+			want:   []string{"a", "b"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var c Config
+			var err error
+			switch tt.format {
+			case "toml":
+				err = DecodeTOML(strings.NewReader(tt.data), &c)
+			case "json":
+				err = json.Unmarshal([]byte(tt.data), &c)
+			case "yaml":
+				err = yaml.Unmarshal([]byte(tt.data), &c)
+			}
+
+			if err != nil {
+				t.Fatalf("decode failed: %v", err)
+			}
+
+			if c.Service.Name != "n" {
+				t.Errorf("service name = %q, want %q", c.Service.Name, "n")
+			}
+
+			var tokens []string
+			for _, p := range c.Provider {
+				tokens = append(tokens, p.APIToken)
+			}
+
+			if strings.Join(tokens, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("provider tokens = %v, want %v", tokens, tt.want)
+			}
+		})
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"strings"
 
 	cfapi "github.com/cloudflare/cloudflare-go"
+	"github.com/goccy/go-json"
 	"go.uber.org/zap"
 )
 
@@ -99,13 +100,7 @@ func (d *cloudflare) FindRecord(ctx context.Context, r Record) (records []Record
 	}
 
 	for _, record := range cfRecords {
-		records = append(records, Record{
-			Handle:  cloudflareHandle{record.ID, zoneRc.Identifier},
-			Domain:  record.Name,
-			Type:    record.Type,
-			Address: record.Content,
-			Mark:    record.Comment,
-		})
+		records = append(records, fromCloudflareRecord(record, zoneRc.Identifier))
 	}
 
 	log.S(ctx).Debugw("find records", "records", records)
@@ -113,6 +108,67 @@ func (d *cloudflare) FindRecord(ctx context.Context, r Record) (records []Record
 	return records, nil
 }
 
+func (d *cloudflare) ListRecords(ctx context.Context, markPrefix string) (records []Record, err error) {
+	ctx = log.SWith(ctx,
+		"type", "cloudflare",
+		"action", "list",
+		"mark", markPrefix)
+
+	api, err := d.getAPI(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for zone, id := range d.zones {
+		cfRecords, _, err := api.ListDNSRecords(ctx, cfapi.ZoneIdentifier(id), cfapi.ListDNSRecordsParams{})
+		if err != nil {
+			log.S(ctx).Errorw("failed list records", "zone", zone, zap.Error(err))
+			return nil, fmt.Errorf("failed list records: %w", err)
+		}
+
+		for _, record := range cfRecords {
+			if strings.HasPrefix(record.Comment, markPrefix) {
+				records = append(records, fromCloudflareRecord(record, id))
+			}
+		}
+	}
+
+	log.S(ctx).Debugw("list records", "records", records)
+
+	return records, nil
+}
+
+func (d *cloudflare) DeleteRecord(ctx context.Context, r Record) error {
+	ctx = log.SWith(ctx,
+		"type", "cloudflare",
+		"action", "delete",
+		"ns_type", r.Type,
+		"domain", r.Domain,
+		"address", r.Address,
+		"handle", r.Handle,
+		"mark", r.Mark)
+
+	handle, ok := r.Handle.(cloudflareHandle)
+	if !ok {
+		log.S(ctx).Errorw("record has no valid handle", log.Internal)
+		return fmt.Errorf("internal error: record has no valid handle")
+	}
+
+	api, err := d.getAPI(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := api.DeleteDNSRecord(ctx, cfapi.ZoneIdentifier(handle.ZoneID), handle.ID); err != nil {
+		log.S(ctx).Warnw("failed delete record", zap.Error(err))
+		return fmt.Errorf("failed delete record: %w", err)
+	}
+
+	log.S(ctx).Debugw("record deleted")
+
+	return nil
+}
+
 func (d *cloudflare) WriteRecord(ctx context.Context, r Record) (Record, error) {
 	pCtx := ctx
 	ctx = log.SWith(ctx,
@@ -141,7 +197,12 @@ func (d *cloudflare) WriteRecord(ctx context.Context, r Record) (Record, error)
 			Name:    r.Domain,
 			Content: r.Address,
 			ID:      handle.ID,
+			TTL:     r.Options.TTL,
+			Proxied: cfapi.BoolPtr(r.Options.Proxied),
 			Comment: &r.Mark,
+			// Tags are always sent, an empty list clears them. Callers not managing tags pass
+			// tags the record has.
+			Tags: append([]string{}, r.Options.Tags...),
 		}
 
 		zoneID = handle.ZoneID
@@ -162,9 +223,10 @@ func (d *cloudflare) WriteRecord(ctx context.Context, r Record) (Record, error)
 			Type:    r.Type,
 			Name:    r.Domain,
 			Content: r.Address,
-			TTL:     d.ttl,
-			Proxied: cfapi.BoolPtr(false),
+			TTL:     r.Options.TTL,
+			Proxied: cfapi.BoolPtr(r.Options.Proxied),
 			Comment: r.Mark,
+			Tags:    r.Options.Tags,
 		}
 
 		cfRecord, err = api.CreateDNSRecord(ctx, zoneRc, params)
@@ -175,26 +237,89 @@ func (d *cloudflare) WriteRecord(ctx context.Context, r Record) (Record, error)
 		}
 	}
 
-	record := Record{
+	record := fromCloudflareRecord(cfRecord, zoneID)
+
+	log.S(pCtx).Debugw("record written", "record", record)
+
+	return record, nil
+}
+
+func checkCloudflareOptions(o RecordOptions) error {
+	if o.TTL < 0 {
+		return fmt.Errorf("bad ttl %d", o.TTL)
+	}
+
+	return nil
+}
+
+func (d *cloudflare) Options(o RecordOptions) (RecordOptions, error) {
+	if err := checkCloudflareOptions(o); err != nil {
+		return RecordOptions{}, err
+	}
+
+	if o.TTL == 0 {
+		o.TTL = d.ttl
+	}
+
+	// TTL of proxied records is always 1, which means automatic.
+	if o.TTL == 0 || o.Proxied {
+		o.TTL = 1
+	}
+
+	return o, nil
+}
+
+func (d *cloudflare) DecodeHandle(data []byte) (any, error) {
+	var handle cloudflareHandle
+	if err := json.Unmarshal(data, &handle); err != nil {
+		return nil, err
+	}
+
+	if handle.ID == "" || handle.ZoneID == "" {
+		return nil, fmt.Errorf("incomplete handle")
+	}
+
+	return handle, nil
+}
+
+func fromCloudflareRecord(record cfapi.DNSRecord, zoneID string) Record {
+	return Record{
 		Handle: cloudflareHandle{
-			ID:     cfRecord.ID,
+			ID:     record.ID,
 			ZoneID: zoneID,
 		},
-		Domain:  cfRecord.Name,
-		Type:    cfRecord.Type,
-		Address: cfRecord.Content,
-		Mark:    cfRecord.Comment,
+		Domain:  record.Name,
+		Type:    record.Type,
+		Address: record.Content,
+		Mark:    record.Comment,
+		Options: RecordOptions{
+			TTL:     record.TTL,
+			Proxied: record.Proxied != nil && *record.Proxied,
+			Tags:    record.Tags,
+		},
 	}
+}
 
-	log.S(pCtx).Debugw("record written", "record", record)
+func cloudflareConfig(provider config.Provider) (config.CloudflareConfig, error) {
+	c := provider.CloudflareConfig
+	err := common.WeakDecodeMap(provider.Config, &c)
+	return c, err
+}
 
-	return record, nil
+func cloudflareZoneNames(provider config.Provider) ([]string, error) {
+	c, err := cloudflareConfig(provider)
+	return c.ZoneNames, err
 }
 
-func newCloudflare(ctx context.Context, provider config.CloudflareConfig) (_ Interface, err error) {
+func newCloudflare(ctx context.Context, provider config.Provider) (_ Interface, err error) {
 	ctx = log.SWith(ctx, "type", "cloudflare")
 
-	c := provider
+	c, err := cloudflareConfig(provider)
+	if err != nil {
+		log.S(ctx).Errorw("bad config", zap.Error(err), "config", provider.Config)
+		return nil, fmt.Errorf(`bad config: %w`, err)
+	}
+
 	d := &cloudflare{
 		token: c.APIToken,
 		zones: map[string]string{},
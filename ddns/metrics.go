@@ -0,0 +1,38 @@
+package ddns
+
+import (
+	"cfddns/metrics"
+	"context"
+	"time"
+)
+
+type instrumented struct {
+	Interface
+
+	name string
+}
+
+// Instrument wraps provider to record latency of its calls in metrics, labelled with name.
+func Instrument(name string, provider Interface) Interface {
+	return &instrumented{Interface: provider, name: name}
+}
+
+func (i *instrumented) FindRecord(ctx context.Context, r Record) (records []Record, err error) {
+	defer func(start time.Time) { metrics.ObserveProvider(i.name, "find", start, err) }(time.Now())
+	return i.Interface.FindRecord(ctx, r)
+}
+
+func (i *instrumented) WriteRecord(ctx context.Context, r Record) (record Record, err error) {
+	defer func(start time.Time) { metrics.ObserveProvider(i.name, "write", start, err) }(time.Now())
+	return i.Interface.WriteRecord(ctx, r)
+}
+
+func (i *instrumented) DeleteRecord(ctx context.Context, r Record) (err error) {
+	defer func(start time.Time) { metrics.ObserveProvider(i.name, "delete", start, err) }(time.Now())
+	return i.Interface.DeleteRecord(ctx, r)
+}
+
+func (i *instrumented) ListRecords(ctx context.Context, markPrefix string) (records []Record, err error) {
+	defer func(start time.Time) { metrics.ObserveProvider(i.name, "list", start, err) }(time.Now())
+	return i.Interface.ListRecords(ctx, markPrefix)
+}
@@ -3,11 +3,23 @@ package ddns
 import (
 	"cfddns/config"
 	"context"
+	"slices"
 )
 
 type Interface interface {
 	FindRecord(ctx context.Context, r Record) ([]Record, error)
 	WriteRecord(ctx context.Context, r Record) (Record, error)
+	DeleteRecord(ctx context.Context, r Record) error
+
+	// ListRecords returns all records in configured zones whose mark starts with markPrefix.
+	ListRecords(ctx context.Context, markPrefix string) ([]Record, error)
+
+	// DecodeHandle restores Record.Handle from its JSON form.
+	DecodeHandle(data []byte) (any, error)
+
+	// Options returns o with unset fields filled by provider defaults, as records have after
+	// written. An error is returned if o is not supported by the provider.
+	Options(o RecordOptions) (RecordOptions, error)
 }
 
 type Record struct {
@@ -16,8 +28,38 @@ type Record struct {
 	Type    string
 	Address string
 	Mark    string
+	Options RecordOptions
 }
 
-var Providers = map[string]func(ctx context.Context, provider config.CloudflareConfig) (Interface, error){
+// RecordOptions are settings of a record besides its content.
+//
+// Nil Tags means tags are not managed. Tags set by others are kept as is.
+type RecordOptions struct {
+	TTL     int      `json:"ttl,omitempty"`
+	Proxied bool     `json:"proxied,omitempty"`
+	Tags    []string `json:"tags,omitempty"`
+}
+
+// Matches reports whether o, options of an existing record, satisfy wanted. Order of tags doesn't
+// matter, and tags are ignored if wanted doesn't manage them.
+func (o RecordOptions) Matches(wanted RecordOptions) bool {
+	return o.TTL == wanted.TTL && o.Proxied == wanted.Proxied && (wanted.Tags == nil ||
+		slices.Equal(slices.Sorted(slices.Values(o.Tags)), slices.Sorted(slices.Values(wanted.Tags))))
+}
+
+var Providers = map[string]func(ctx context.Context, provider config.Provider) (Interface, error){
 	"cloudflare": newCloudflare,
+	"rfc2136":    newRFC2136,
+}
+
+// ZoneNames returns zones configured for each provider type, without accessing network.
+var ZoneNames = map[string]func(provider config.Provider) ([]string, error){
+	"cloudflare": cloudflareZoneNames,
+	"rfc2136":    rfc2136ZoneNames,
+}
+
+// CheckOptions validates record options for each provider type, without accessing network.
+var CheckOptions = map[string]func(o RecordOptions) error{
+	"cloudflare": checkCloudflareOptions,
+	"rfc2136":    checkRFC2136Options,
 }
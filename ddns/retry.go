@@ -0,0 +1,136 @@
+package ddns
+
+import (
+	"cfddns/config"
+	"cfddns/log"
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultRetryAttempts   = 1
+	defaultRetryBackoff    = time.Second
+	defaultRetryMaxBackoff = 30 * time.Second
+	defaultRetryJitter     = 0.2
+)
+
+type retrying struct {
+	Interface
+
+	attempts   int
+	backoff    time.Duration
+	maxBackoff time.Duration
+	jitter     float64
+}
+
+// WithRetry wraps provider to retry failed writes and deletes, with exponential backoff.
+// Retry is disabled unless more than 1 attempt is configured.
+func WithRetry(provider Interface, c config.Retry) (Interface, error) {
+	r := &retrying{
+		Interface:  provider,
+		attempts:   c.Attempts,
+		backoff:    time.Duration(c.Backoff),
+		maxBackoff: time.Duration(c.MaxBackoff),
+		jitter:     defaultRetryJitter,
+	}
+
+	if r.attempts == 0 {
+		r.attempts = defaultRetryAttempts
+	}
+
+	if r.backoff == 0 {
+		r.backoff = defaultRetryBackoff
+	}
+
+	if r.maxBackoff == 0 {
+		r.maxBackoff = defaultRetryMaxBackoff
+	}
+
+	if c.Jitter != nil {
+		r.jitter = *c.Jitter
+	}
+
+	switch {
+	case r.attempts < 0:
+		return nil, fmt.Errorf("bad retry attempts %d", r.attempts)
+	case r.backoff < 0 || r.maxBackoff < r.backoff:
+		return nil, fmt.Errorf("bad retry backoff %s, max %s", r.backoff, r.maxBackoff)
+	case r.jitter < 0 || r.jitter > 1:
+		return nil, fmt.Errorf("bad retry jitter %v", r.jitter)
+	}
+
+	return r, nil
+}
+
+// do calls fn until it succeeds or attempts are used up. Delay between attempts doubles each time,
+// and is randomly changed by at most jitter times of it.
+func (r *retrying) do(ctx context.Context, fn func() error) error {
+	delay := r.backoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= r.attempts || ctx.Err() != nil {
+			return err
+		}
+
+		wait := time.Duration(float64(delay) * (1 + r.jitter*(2*rand.Float64()-1)))
+		log.S(ctx).Warnw("provider call failed, will retry", "attempt", attempt, "delay", wait, zap.Error(err))
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return err
+		}
+
+		delay = min(delay*2, r.maxBackoff)
+	}
+}
+
+func (r *retrying) WriteRecord(ctx context.Context, record Record) (written Record, err error) {
+	tried := false
+	err = r.do(ctx, func() (err error) {
+		// Creating is not idempotent. The record may have been created by the failed attempt,
+		// e.g. the response timed out, and should not be created again.
+		if record.Handle == nil && tried {
+			if found, err := r.created(ctx, record); err != nil || found != nil {
+				if found != nil {
+					written = *found
+				}
+
+				return err
+			}
+		}
+
+		tried = true
+		written, err = r.Interface.WriteRecord(ctx, record)
+		return err
+	})
+
+	return written, err
+}
+
+// created finds the record created by a failed attempt of creating record, if any.
+func (r *retrying) created(ctx context.Context, record Record) (*Record, error) {
+	records, err := r.Interface.FindRecord(ctx, record)
+	if err != nil {
+		return nil, fmt.Errorf("failed checking created record: %w", err)
+	}
+
+	for _, found := range records {
+		if found.Address == record.Address {
+			log.S(ctx).Infow("record was created by the failed attempt", "ip", found.Address)
+			return &found, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (r *retrying) DeleteRecord(ctx context.Context, record Record) error {
+	return r.do(ctx, func() error {
+		return r.Interface.DeleteRecord(ctx, record)
+	})
+}
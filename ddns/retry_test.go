@@ -0,0 +1,117 @@
+package ddns
+
+import (
+	"cfddns/common"
+	"cfddns/config"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// flakyProvider fails the first failures writes. If lost is set, failed creates still create the
+// record, as if only the response is lost.
+type flakyProvider struct {
+	Interface
+
+	failures int
+	lost     bool
+	writes   int
+	records  []Record
+}
+
+func (p *flakyProvider) WriteRecord(ctx context.Context, r Record) (Record, error) {
+	p.writes++
+	if r.Handle == nil {
+		r.Handle = len(p.records) + 1
+		if p.writes <= p.failures && !p.lost {
+			return r, errors.New("write failed")
+		}
+
+		p.records = append(p.records, r)
+	}
+
+	if p.writes <= p.failures {
+		return r, errors.New("response lost")
+	}
+
+	return r, nil
+}
+
+func (p *flakyProvider) FindRecord(ctx context.Context, r Record) ([]Record, error) {
+	return p.records, nil
+}
+
+func TestRetryWriteRecord(t *testing.T) {
+	jitter := 0.0
+	tests := []struct {
+		name     string
+		retry    config.Retry
+		failures int
+		lost     bool
+		update   bool
+		wantErr  bool
+		writes   int
+		records  int
+	}{
+		{name: "disabled by default", failures: 1, wantErr: true, writes: 1},
+		{name: "create succeeds on retry", retry: config.Retry{Attempts: 3}, failures: 2, writes: 3, records: 1},
+		{name: "attempts used up", retry: config.Retry{Attempts: 2}, failures: 2, wantErr: true, writes: 2},
+		{name: "update succeeds on retry", retry: config.Retry{Attempts: 3}, failures: 2, update: true, writes: 3},
+		{name: "lost create not repeated", retry: config.Retry{Attempts: 3}, failures: 1, lost: true, writes: 1, records: 1},
+		{name: "no jitter", retry: config.Retry{Attempts: 2, Jitter: &jitter}, failures: 1, writes: 2, records: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.retry.Backoff = common.Duration(time.Millisecond)
+			p := &flakyProvider{failures: tt.failures, lost: tt.lost}
+			r, err := WithRetry(p, tt.retry)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			record := Record{Domain: "a.example.com", Type: "A", Address: "192.0.2.1"}
+			if tt.update {
+				record.Handle = 1
+			}
+
+			written, err := r.WriteRecord(context.Background(), record)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+
+			if err == nil && written.Handle == nil {
+				t.Error("written record has no handle")
+			}
+
+			if p.writes != tt.writes {
+				t.Errorf("writes = %d, want %d", p.writes, tt.writes)
+			}
+
+			if len(p.records) != tt.records {
+				t.Errorf("records = %d, want %d", len(p.records), tt.records)
+			}
+		})
+	}
+}
+
+func TestRetryConfig(t *testing.T) {
+	jitter := 1.5
+	tests := []struct {
+		name  string
+		retry config.Retry
+	}{
+		{name: "negative attempts", retry: config.Retry{Attempts: -1}},
+		{name: "max below backoff", retry: config.Retry{Backoff: common.Duration(time.Minute), MaxBackoff: common.Duration(time.Second)}},
+		{name: "jitter out of range", retry: config.Retry{Jitter: &jitter}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := WithRetry(nil, tt.retry); err == nil {
+				t.Error("bad config accepted")
+			}
+		})
+	}
+}
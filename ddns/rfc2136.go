@@ -0,0 +1,536 @@
+package ddns
+
+import (
+	"cfddns/common"
+	"cfddns/config"
+	"cfddns/log"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/miekg/dns"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultRFC2136TTL       = 60
+	defaultRFC2136Timeout   = 10 * time.Second
+	defaultRFC2136MarkLabel = "_cfddns"
+	rfc2136TSIGFudge        = 300
+)
+
+// rfc2136 publishes records with DNS UPDATE messages (RFC 2136).
+//
+// Since DNS records have no comment, the mark of every managed record is kept
+// in a companion TXT record at <mark_label>.<domain>, holding "<mark> <type> <address>".
+type rfc2136 struct {
+	server    string
+	network   string
+	zones     []string
+	ttl       uint32
+	timeout   time.Duration
+	markLabel string
+
+	tsigKey       string
+	tsigSecret    string
+	tsigAlgorithm string
+}
+
+type rfc2136Handle struct {
+	Address string
+	// Mark is the mark the record is written with, so the mark can be replaced on update.
+	Mark string `json:",omitempty"`
+}
+
+func (d *rfc2136) exchange(ctx context.Context, m *dns.Msg) (*dns.Msg, error) {
+	c := &dns.Client{Net: d.network, Timeout: d.timeout}
+
+	if d.tsigKey != "" {
+		c.TsigSecret = map[string]string{d.tsigKey: d.tsigSecret}
+		m.SetTsig(d.tsigKey, d.tsigAlgorithm, rfc2136TSIGFudge, time.Now().Unix())
+	}
+
+	resp, _, err := c.ExchangeContext(ctx, m, d.server)
+	if err != nil {
+		log.S(ctx).Warnw("dns exchange failed", zap.Error(err))
+		return nil, fmt.Errorf("dns exchange failed: %w", err)
+	}
+
+	return resp, nil
+}
+
+func (d *rfc2136) query(ctx context.Context, name string, qtype uint16) ([]dns.RR, error) {
+	ctx = log.SWith(ctx, "query", name, "query_type", dns.TypeToString[qtype])
+
+	m := new(dns.Msg)
+	m.SetQuestion(name, qtype)
+	m.RecursionDesired = false
+
+	resp, err := d.exchange(ctx, m)
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.Rcode {
+	case dns.RcodeSuccess, dns.RcodeNameError:
+	default:
+		log.S(ctx).Warnw("query failed", "rcode", dns.RcodeToString[resp.Rcode])
+		return nil, fmt.Errorf("query failed: %s", dns.RcodeToString[resp.Rcode])
+	}
+
+	var answer []dns.RR
+	for _, rr := range resp.Answer {
+		if rr.Header().Rrtype == qtype && strings.EqualFold(rr.Header().Name, name) {
+			answer = append(answer, rr)
+		}
+	}
+
+	return answer, nil
+}
+
+func (d *rfc2136) transfer(ctx context.Context, zone string) ([]dns.RR, error) {
+	ctx = log.SWith(ctx, "zone", zone)
+
+	m := new(dns.Msg)
+	m.SetAxfr(zone)
+
+	t := &dns.Transfer{DialTimeout: d.timeout, ReadTimeout: d.timeout, WriteTimeout: d.timeout}
+	if d.tsigKey != "" {
+		t.TsigSecret = map[string]string{d.tsigKey: d.tsigSecret}
+		m.SetTsig(d.tsigKey, d.tsigAlgorithm, rfc2136TSIGFudge, time.Now().Unix())
+	}
+
+	ch, err := t.In(m, d.server)
+	if err != nil {
+		log.S(ctx).Warnw("zone transfer failed", zap.Error(err))
+		return nil, fmt.Errorf("zone transfer failed: %w", err)
+	}
+
+	var rrs []dns.RR
+	for env := range ch {
+		if env.Error != nil {
+			log.S(ctx).Warnw("zone transfer failed", zap.Error(env.Error))
+			return nil, fmt.Errorf("zone transfer failed: %w", env.Error)
+		}
+
+		rrs = append(rrs, env.RR...)
+	}
+
+	return rrs, nil
+}
+
+func (d *rfc2136) update(ctx context.Context, zone string, remove, insert []dns.RR) error {
+	m := new(dns.Msg)
+	m.SetUpdate(zone)
+
+	if len(remove) != 0 {
+		m.Remove(remove)
+	}
+
+	if len(insert) != 0 {
+		m.Insert(insert)
+	}
+
+	resp, err := d.exchange(ctx, m)
+	if err != nil {
+		return err
+	}
+
+	if resp.Rcode != dns.RcodeSuccess {
+		log.S(ctx).Warnw("update rejected", "rcode", dns.RcodeToString[resp.Rcode])
+		return fmt.Errorf("update rejected: %s", dns.RcodeToString[resp.Rcode])
+	}
+
+	return nil
+}
+
+func (d *rfc2136) getZone(ctx context.Context, domain string) (string, error) {
+	name := dns.Fqdn(domain)
+
+	zone := ""
+	for _, z := range d.zones {
+		if dns.IsSubDomain(z, name) && len(z) > len(zone) {
+			zone = z
+		}
+	}
+
+	if zone == "" {
+		log.S(ctx).Errorw("domain not belong to any zone", "domain", domain)
+		return "", fmt.Errorf("domain not belong to any zone")
+	}
+
+	return zone, nil
+}
+
+func (d *rfc2136) markName(name string) string {
+	return d.markLabel + "." + name
+}
+
+func (d *rfc2136) markContent(r Record) string {
+	return fmt.Sprintf("%s %s %s", r.Mark, r.Type, r.Address)
+}
+
+func (d *rfc2136) recordRR(name string, r Record) (dns.RR, error) {
+	ttl := d.ttl
+	if r.Options.TTL > 0 {
+		ttl = uint32(r.Options.TTL)
+	}
+
+	return dns.NewRR(fmt.Sprintf("%s %d IN %s %s", name, ttl, r.Type, r.Address))
+}
+
+func (d *rfc2136) markRR(name string, r Record) dns.RR {
+	return &dns.TXT{
+		Hdr: dns.RR_Header{Name: d.markName(name), Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: d.ttl},
+		Txt: []string{d.markContent(r)},
+	}
+}
+
+func rrAddress(rr dns.RR) string {
+	switch rr := rr.(type) {
+	case *dns.A:
+		return rr.A.String()
+	case *dns.AAAA:
+		return rr.AAAA.String()
+	default:
+		return ""
+	}
+}
+
+func (d *rfc2136) FindRecord(ctx context.Context, r Record) (records []Record, err error) {
+	ctx = log.SWith(ctx,
+		"action", "find",
+		"ns_type", r.Type,
+		"domain", r.Domain,
+		"mark", r.Mark)
+
+	qtype, ok := dns.StringToType[r.Type]
+	if !ok {
+		log.S(ctx).Errorw("unknown record type")
+		return nil, fmt.Errorf("unknown record type")
+	}
+
+	if _, err := d.getZone(ctx, r.Domain); err != nil {
+		return nil, err
+	}
+
+	name := dns.Fqdn(r.Domain)
+
+	rrs, err := d.query(ctx, name, qtype)
+	if err != nil {
+		return nil, fmt.Errorf("failed list records: %w", err)
+	}
+
+	marks, err := d.query(ctx, d.markName(name), dns.TypeTXT)
+	if err != nil {
+		return nil, fmt.Errorf("failed list marks: %w", err)
+	}
+
+	ttls := map[string]uint32{}
+	for _, rr := range rrs {
+		ttls[rrAddress(rr)] = rr.Header().Ttl
+	}
+
+	for _, rr := range marks {
+		fields := strings.Fields(strings.Join(rr.(*dns.TXT).Txt, ""))
+		if len(fields) != 3 || fields[0] != r.Mark || fields[1] != r.Type {
+			continue
+		}
+
+		ttl, exist := ttls[fields[2]]
+		if !exist {
+			log.S(ctx).Warnw("ignore mark without record", "address", fields[2])
+			continue
+		}
+
+		records = append(records, Record{
+			Handle:  rfc2136Handle{Address: fields[2], Mark: r.Mark},
+			Domain:  r.Domain,
+			Type:    r.Type,
+			Address: fields[2],
+			Mark:    r.Mark,
+			Options: RecordOptions{TTL: int(ttl)},
+		})
+	}
+
+	log.S(ctx).Debugw("find records", "records", records)
+
+	return records, nil
+}
+
+func (d *rfc2136) WriteRecord(ctx context.Context, r Record) (Record, error) {
+	pCtx := ctx
+	ctx = log.SWith(ctx,
+		"type", "rfc2136",
+		"action", "write",
+		"ns_type", r.Type,
+		"domain", r.Domain,
+		"address", r.Address,
+		"handle", r.Handle,
+		"mark", r.Mark)
+
+	zone, err := d.getZone(ctx, r.Domain)
+	if err != nil {
+		return Record{}, err
+	}
+
+	name := dns.Fqdn(r.Domain)
+
+	rr, err := d.recordRR(name, r)
+	if err != nil {
+		log.S(ctx).Errorw("bad record", zap.Error(err))
+		return Record{}, fmt.Errorf("bad record: %w", err)
+	}
+
+	var remove []dns.RR
+	if r.Handle != nil {
+		log.S(ctx).Debugw("updating record")
+		handle := r.Handle.(rfc2136Handle)
+		old := r
+		old.Address = handle.Address
+		if handle.Mark != "" {
+			old.Mark = handle.Mark
+		}
+
+		oldRR, err := d.recordRR(name, old)
+		if err != nil {
+			log.S(ctx).Errorw("bad old record", zap.Error(err))
+			return Record{}, fmt.Errorf("bad old record: %w", err)
+		}
+
+		remove = []dns.RR{oldRR, d.markRR(name, old)}
+	} else {
+		log.S(ctx).Debugw("creating record")
+	}
+
+	if err := d.update(ctx, zone, remove, []dns.RR{rr, d.markRR(name, r)}); err != nil {
+		return Record{}, fmt.Errorf("failed write record: %w", err)
+	}
+
+	record := Record{
+		Handle:  rfc2136Handle{Address: r.Address, Mark: r.Mark},
+		Domain:  r.Domain,
+		Type:    r.Type,
+		Address: r.Address,
+		Mark:    r.Mark,
+		Options: RecordOptions{TTL: int(rr.Header().Ttl)},
+	}
+
+	log.S(pCtx).Debugw("record written", "record", record)
+
+	return record, nil
+}
+
+func (d *rfc2136) DeleteRecord(ctx context.Context, r Record) error {
+	ctx = log.SWith(ctx,
+		"type", "rfc2136",
+		"action", "delete",
+		"ns_type", r.Type,
+		"domain", r.Domain,
+		"address", r.Address,
+		"handle", r.Handle,
+		"mark", r.Mark)
+
+	handle, ok := r.Handle.(rfc2136Handle)
+	if !ok {
+		log.S(ctx).Errorw("record has no valid handle", log.Internal)
+		return fmt.Errorf("internal error: record has no valid handle")
+	}
+
+	zone, err := d.getZone(ctx, r.Domain)
+	if err != nil {
+		return err
+	}
+
+	name := dns.Fqdn(r.Domain)
+	r.Address = handle.Address
+
+	rr, err := d.recordRR(name, r)
+	if err != nil {
+		log.S(ctx).Errorw("bad record", zap.Error(err))
+		return fmt.Errorf("bad record: %w", err)
+	}
+
+	if err := d.update(ctx, zone, []dns.RR{rr, d.markRR(name, r)}, nil); err != nil {
+		return fmt.Errorf("failed delete record: %w", err)
+	}
+
+	log.S(ctx).Debugw("record deleted")
+
+	return nil
+}
+
+func (d *rfc2136) ListRecords(ctx context.Context, markPrefix string) (records []Record, err error) {
+	ctx = log.SWith(ctx,
+		"type", "rfc2136",
+		"action", "list",
+		"mark", markPrefix)
+
+	markPrefixLabel := dns.CanonicalName(d.markLabel)
+
+	for _, zone := range d.zones {
+		rrs, err := d.transfer(ctx, zone)
+		if err != nil {
+			return nil, fmt.Errorf("failed list records: %w", err)
+		}
+
+		type recordKey struct{ name, nsType, address string }
+		existing := map[recordKey]struct{}{}
+		for _, rr := range rrs {
+			if address := rrAddress(rr); address != "" {
+				existing[recordKey{dns.CanonicalName(rr.Header().Name), dns.TypeToString[rr.Header().Rrtype], address}] = struct{}{}
+			}
+		}
+
+		for _, rr := range rrs {
+			txt, ok := rr.(*dns.TXT)
+			if !ok || !strings.HasPrefix(dns.CanonicalName(txt.Hdr.Name), markPrefixLabel) {
+				continue
+			}
+
+			fields := strings.Fields(strings.Join(txt.Txt, ""))
+			if len(fields) != 3 || !strings.HasPrefix(fields[0], markPrefix) {
+				continue
+			}
+
+			name := strings.TrimPrefix(dns.CanonicalName(txt.Hdr.Name), markPrefixLabel)
+			if _, exist := existing[recordKey{name, fields[1], fields[2]}]; !exist {
+				log.S(ctx).Warnw("ignore mark without record", "domain", name, "ns_type", fields[1], "address", fields[2])
+				continue
+			}
+
+			records = append(records, Record{
+				Handle:  rfc2136Handle{Address: fields[2], Mark: fields[0]},
+				Domain:  strings.TrimSuffix(name, "."),
+				Type:    fields[1],
+				Address: fields[2],
+				Mark:    fields[0],
+			})
+		}
+	}
+
+	log.S(ctx).Debugw("list records", "records", records)
+
+	return records, nil
+}
+
+func checkRFC2136Options(o RecordOptions) error {
+	switch {
+	case o.TTL < 0:
+		return fmt.Errorf("bad ttl %d", o.TTL)
+	case o.Proxied:
+		return fmt.Errorf("proxied is not supported by rfc2136 provider")
+	case len(o.Tags) != 0:
+		return fmt.Errorf("tags are not supported by rfc2136 provider")
+	}
+
+	return nil
+}
+
+func (d *rfc2136) Options(o RecordOptions) (RecordOptions, error) {
+	if err := checkRFC2136Options(o); err != nil {
+		return RecordOptions{}, err
+	}
+
+	if o.TTL == 0 {
+		o.TTL = int(d.ttl)
+	}
+
+	return o, nil
+}
+
+func (d *rfc2136) DecodeHandle(data []byte) (any, error) {
+	var handle rfc2136Handle
+	if err := json.Unmarshal(data, &handle); err != nil {
+		return nil, err
+	}
+
+	if handle.Address == "" {
+		return nil, fmt.Errorf("incomplete handle")
+	}
+
+	return handle, nil
+}
+
+func rfc2136ZoneNames(provider config.Provider) ([]string, error) {
+	var c config.ProviderRFC2136Config
+	err := common.WeakDecodeMap(provider.Config, &c)
+	return c.ZoneNames, err
+}
+
+func newRFC2136(ctx context.Context, provider config.Provider) (_ Interface, err error) {
+	ctx = log.SWith(ctx, "type", "rfc2136")
+
+	var c config.ProviderRFC2136Config
+	if err := common.WeakDecodeMap(provider.Config, &c); err != nil {
+		log.S(ctx).Errorw("bad config", zap.Error(err), "config", provider.Config)
+		return nil, fmt.Errorf(`bad config: %w`, err)
+	}
+
+	d := &rfc2136{
+		server:        c.Server,
+		network:       c.Network,
+		ttl:           uint32(c.TTL),
+		timeout:       time.Duration(c.Timeout),
+		markLabel:     c.MarkLabel,
+		tsigSecret:    c.TSIGSecret,
+		tsigAlgorithm: dns.HmacSHA256,
+	}
+
+	if d.server == "" {
+		log.S(ctx).Errorw("bad config: server not set")
+		return nil, fmt.Errorf("bad config: server not set")
+	}
+
+	if _, _, err := net.SplitHostPort(d.server); err != nil {
+		d.server = net.JoinHostPort(strings.Trim(d.server, "[]"), "53")
+	}
+
+	if d.network == "" {
+		d.network = "tcp"
+	}
+
+	if d.ttl == 0 {
+		d.ttl = defaultRFC2136TTL
+	}
+
+	if d.timeout == 0 {
+		d.timeout = defaultRFC2136Timeout
+	}
+
+	if d.markLabel == "" {
+		d.markLabel = defaultRFC2136MarkLabel
+	}
+
+	if c.TSIGKey != "" {
+		d.tsigKey = dns.Fqdn(c.TSIGKey)
+	}
+
+	if c.TSIGAlgorithm != "" {
+		d.tsigAlgorithm = dns.Fqdn(strings.ToLower(c.TSIGAlgorithm))
+	}
+
+	ctx = log.SWith(ctx, "server", d.server, "network", d.network)
+
+	for _, name := range c.ZoneNames {
+		zone := dns.Fqdn(name)
+
+		soa, err := d.query(ctx, zone, dns.TypeSOA)
+		if err != nil {
+			log.S(ctx).Errorw("failed get zone", "zone", name, zap.Error(err))
+			return nil, fmt.Errorf("failed get zone: %w", err)
+		}
+
+		if len(soa) == 0 {
+			log.S(ctx).Errorw("server is not authoritative for zone", "zone", name)
+			return nil, fmt.Errorf("server is not authoritative for zone %s", name)
+		}
+
+		d.zones = append(d.zones, zone)
+	}
+
+	return d, nil
+}
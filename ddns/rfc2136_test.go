@@ -0,0 +1,300 @@
+package ddns
+
+import (
+	"cfddns/config"
+	"context"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	testTSIGKey    = "cfddns."
+	testTSIGSecret = "c2VjcmV0LXNlY3JldC1zZWNyZXQtc2VjcmV0LXNlY3JldA=="
+	testZone       = "example.com."
+)
+
+// dnsServer is an authoritative server of testZone, accepting updates and zone transfers signed
+// with testTSIGKey.
+type dnsServer struct {
+	mu   sync.Mutex
+	zone []dns.RR
+	addr string
+}
+
+func newDNSServer(t *testing.T) *dnsServer {
+	s := &dnsServer{}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.addr = l.Addr().String()
+	server := &dns.Server{
+		Listener:   l,
+		TsigSecret: map[string]string{testTSIGKey: testTSIGSecret},
+		Handler:    dns.HandlerFunc(s.serve),
+		// Updates are rejected by the default accept function.
+		MsgAcceptFunc: func(dns.Header) dns.MsgAcceptAction { return dns.MsgAccept },
+	}
+
+	go func() {
+		_ = server.ActivateAndServe()
+	}()
+
+	t.Cleanup(func() {
+		_ = server.Shutdown()
+	})
+
+	return s
+}
+
+func (s *dnsServer) serve(w dns.ResponseWriter, r *dns.Msg) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m := new(dns.Msg)
+	m.SetReply(r)
+	defer func() {
+		if r.IsTsig() != nil {
+			m.SetTsig(testTSIGKey, dns.HmacSHA256, 300, int64(r.IsTsig().TimeSigned))
+		}
+
+		_ = w.WriteMsg(m)
+	}()
+
+	signed := r.IsTsig() != nil && w.TsigStatus() == nil
+	soa := &dns.SOA{Hdr: dns.RR_Header{Name: testZone, Rrtype: dns.TypeSOA, Class: dns.ClassINET}, Ns: "ns.example.com.", Mbox: "admin.example.com.", Serial: 1}
+
+	if r.Opcode == dns.OpcodeUpdate {
+		if !signed {
+			m.Rcode = dns.RcodeRefused
+			return
+		}
+
+		for _, rr := range r.Ns {
+			if rr.Header().Class == dns.ClassNONE {
+				s.zone = slices.DeleteFunc(s.zone, func(existing dns.RR) bool {
+					rr := dns.Copy(rr)
+					rr.Header().Class = dns.ClassINET
+					rr.Header().Ttl = existing.Header().Ttl
+					return dns.IsDuplicate(existing, rr)
+				})
+			} else {
+				s.zone = append(s.zone, rr)
+			}
+		}
+
+		return
+	}
+
+	q := r.Question[0]
+	switch {
+	case q.Qtype == dns.TypeAXFR:
+		if !signed {
+			m.Rcode = dns.RcodeRefused
+			return
+		}
+
+		m.Answer = slices.Concat([]dns.RR{soa}, s.zone, []dns.RR{soa})
+	case q.Qtype == dns.TypeSOA && strings.EqualFold(q.Name, testZone):
+		m.Answer = []dns.RR{soa}
+	default:
+		for _, rr := range s.zone {
+			if rr.Header().Rrtype == q.Qtype && strings.EqualFold(rr.Header().Name, q.Name) {
+				m.Answer = append(m.Answer, rr)
+			}
+		}
+	}
+}
+
+// contents returns records in zone of type at name, in text form without TTL.
+func (s *dnsServer) contents(name string, rrtype uint16) (contents []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, rr := range s.zone {
+		if rr.Header().Rrtype == rrtype && strings.EqualFold(rr.Header().Name, name) {
+			contents = append(contents, strings.TrimPrefix(rr.String(), rr.Header().String()))
+		}
+	}
+
+	slices.Sort(contents)
+	return contents
+}
+
+func newTestRFC2136(s *dnsServer, secret string) (Interface, error) {
+	return newRFC2136(context.Background(), config.Provider{Config: map[string]any{
+		"server":      s.addr,
+		"zone_names":  []any{"example.com"},
+		"tsig_key":    "cfddns",
+		"tsig_secret": secret,
+	}})
+}
+
+func TestRFC2136Records(t *testing.T) {
+	ctx := context.Background()
+	s := newDNSServer(t)
+	d, err := newTestRFC2136(s, testTSIGSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := Record{Domain: "a.example.com", Type: "A", Mark: "cfddns-test", Options: RecordOptions{TTL: 120}}
+
+	// Records of other instances under the same name are never touched.
+	other := template
+	other.Mark = "cfddns-other"
+	other.Address = "192.0.2.100"
+	if _, err := d.WriteRecord(ctx, other); err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		name  string
+		do    func(records []Record) error
+		want  []string
+		marks []string
+	}{
+		{
+			name: "create",
+			do: func([]Record) error {
+				r := template
+				r.Address = "192.0.2.1"
+				_, err := d.WriteRecord(ctx, r)
+				return err
+			},
+			want:  []string{"192.0.2.1", "192.0.2.100"},
+			marks: []string{`"cfddns-other A 192.0.2.100"`, `"cfddns-test A 192.0.2.1"`},
+		},
+		{
+			name: "update",
+			do: func(records []Record) error {
+				r := records[0]
+				r.Address = "192.0.2.2"
+				_, err := d.WriteRecord(ctx, r)
+				return err
+			},
+			want:  []string{"192.0.2.100", "192.0.2.2"},
+			marks: []string{`"cfddns-other A 192.0.2.100"`, `"cfddns-test A 192.0.2.2"`},
+		},
+		{
+			name: "delete",
+			do: func(records []Record) error {
+				return d.DeleteRecord(ctx, records[0])
+			},
+			want:  []string{"192.0.2.100"},
+			marks: []string{`"cfddns-other A 192.0.2.100"`},
+		},
+	}
+
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			records, err := d.FindRecord(ctx, template)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := step.do(records); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := s.contents("a.example.com.", dns.TypeA); !slices.Equal(got, step.want) {
+				t.Errorf("A records = %v, want %v", got, step.want)
+			}
+
+			if got := s.contents("_cfddns.a.example.com.", dns.TypeTXT); !slices.Equal(got, step.marks) {
+				t.Errorf("marks = %v, want %v", got, step.marks)
+			}
+
+			records, err = d.FindRecord(ctx, template)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, record := range records {
+				if record.Mark != template.Mark || record.Options.TTL != 120 {
+					t.Errorf("found record %+v, want mark %q and ttl 120", record, template.Mark)
+				}
+			}
+		})
+	}
+}
+
+// Updating a record with another mark replaces its mark, instead of leaving the old one behind.
+func TestRFC2136Remark(t *testing.T) {
+	ctx := context.Background()
+	s := newDNSServer(t)
+	d, err := newTestRFC2136(s, testTSIGSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := Record{Domain: "a.example.com", Type: "A", Mark: "cfddns-test", Address: "192.0.2.1"}
+	if _, err := d.WriteRecord(ctx, r); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := d.FindRecord(ctx, r)
+	if err != nil || len(records) != 1 {
+		t.Fatalf("records = %v, err = %v", records, err)
+	}
+
+	r = records[0]
+	r.Mark = "cfddns@test"
+	if _, err := d.WriteRecord(ctx, r); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{`"cfddns@test A 192.0.2.1"`}
+	if got := s.contents("_cfddns.a.example.com.", dns.TypeTXT); !slices.Equal(got, want) {
+		t.Errorf("marks = %v, want %v", got, want)
+	}
+}
+
+func TestRFC2136ListRecords(t *testing.T) {
+	ctx := context.Background()
+	s := newDNSServer(t)
+	d, err := newTestRFC2136(s, testTSIGSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, r := range []Record{
+		{Domain: "a.example.com", Type: "A", Address: "192.0.2.1", Mark: "cfddns-test"},
+		{Domain: "b.example.com", Type: "AAAA", Address: "2001:db8::1", Mark: "cfddns-test-home"},
+		{Domain: "c.example.com", Type: "A", Address: "192.0.2.3", Mark: "cfddns-other"},
+	} {
+		if _, err := d.WriteRecord(ctx, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	records, err := d.ListRecords(ctx, "cfddns-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, r := range records {
+		got = append(got, r.Domain+" "+r.Type+" "+r.Address+" "+r.Mark)
+	}
+
+	slices.Sort(got)
+	want := []string{"a.example.com A 192.0.2.1 cfddns-test", "b.example.com AAAA 2001:db8::1 cfddns-test-home"}
+	if !slices.Equal(got, want) {
+		t.Errorf("records = %v, want %v", got, want)
+	}
+}
+
+func TestRFC2136BadTSIG(t *testing.T) {
+	s := newDNSServer(t)
+	if _, err := newTestRFC2136(s, "d3Jvbmctc2VjcmV0"); err == nil {
+		t.Error("provider with wrong tsig secret created")
+	}
+}
@@ -0,0 +1,80 @@
+package hooks
+
+import (
+	"bytes"
+	"cfddns/common"
+	"cfddns/config"
+	"cfddns/log"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type execCommand struct {
+	config.HookExecConfig `mapstructure:",squash"`
+
+	path string
+	args []string
+}
+
+func (h *execCommand) Typename() string {
+	return "exec"
+}
+
+func (h *execCommand) Run(ctx context.Context, event Event) error {
+	ctx = log.SWith(ctx, "command", h.path, "args", h.args)
+
+	var output bytes.Buffer
+	cmd := exec.CommandContext(ctx, h.path, h.args...)
+	cmd.Env = append(os.Environ(), event.Env()...)
+	for k, v := range h.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+
+	cmd.Dir = h.Dir
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	// Don't wait forever for children holding output pipes after the command is killed.
+	cmd.WaitDelay = time.Second
+
+	err := cmd.Run()
+
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr):
+		log.S(ctx).Warnw("command failed", "exit_code", exitErr.ExitCode(), log.ByteField("output", output.Bytes()))
+		return fmt.Errorf("command failed: %w", err)
+	case err != nil:
+		log.S(ctx).Warnw("cannot run command", zap.Error(err))
+		return fmt.Errorf("cannot run command: %w", err)
+	}
+
+	log.S(ctx).Debugw("command finished", log.ByteField("output", output.Bytes()))
+	return nil
+}
+
+func newExec(ctx context.Context, hook config.Hook) (Interface, error) {
+	h := &execCommand{}
+	if err := common.WeakDecodeMap(hook.Config, h); err != nil {
+		log.S(ctx).Errorw("bad config", zap.Error(err), "config", hook.Config)
+		return nil, fmt.Errorf(`bad config: %w`, err)
+	}
+
+	// Quoting is not supported, use args for arguments containing spaces.
+	command := strings.Fields(hook.Target)
+	if len(command) == 0 {
+		log.S(ctx).Errorw("command not set")
+		return nil, fmt.Errorf("command not set")
+	}
+
+	h.path = command[0]
+	h.args = append(command[1:], h.Args...)
+
+	return h, nil
+}
@@ -0,0 +1,175 @@
+package hooks
+
+import (
+	"cfddns/common"
+	"cfddns/config"
+	"cfddns/log"
+	"cfddns/metrics"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultTimeout    = 10 * time.Second
+	defaultRetryDelay = time.Second
+)
+
+type Interface interface {
+	Run(ctx context.Context, event Event) error
+	Typename() string
+}
+
+var Hooks = map[string]func(ctx context.Context, hook config.Hook) (Interface, error){
+	"exec":    newExec,
+	"webhook": newWebhook,
+}
+
+// Event describes a record change written to provider.
+type Event struct {
+	Action   string    `json:"action"`
+	Provider string    `json:"provider"`
+	Domain   string    `json:"domain"`
+	Type     string    `json:"type"`
+	Mark     string    `json:"mark"`
+	Address  string    `json:"address"`
+	OldIP    string    `json:"old_ip,omitempty"`
+	NewIP    string    `json:"new_ip,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// Env returns event as environment variables.
+func (e Event) Env() []string {
+	return []string{
+		"CFDDNS_ACTION=" + e.Action,
+		"CFDDNS_PROVIDER=" + e.Provider,
+		"CFDDNS_DOMAIN=" + e.Domain,
+		"CFDDNS_TYPE=" + e.Type,
+		"CFDDNS_MARK=" + e.Mark,
+		"CFDDNS_ADDRESS=" + e.Address,
+		"CFDDNS_OLD_IP=" + e.OldIP,
+		"CFDDNS_NEW_IP=" + e.NewIP,
+		"CFDDNS_TIME=" + e.Time.Format(time.RFC3339),
+	}
+}
+
+// Hook is a configured hook with its timeout and retry policy.
+type Hook struct {
+	Interface
+
+	name       string
+	timeout    time.Duration
+	retry      int
+	retryDelay time.Duration
+}
+
+func (h *Hook) Name() string {
+	return h.name
+}
+
+// run runs the hook until it succeeds or retries are exhausted. The retry delay doubles each time.
+func (h *Hook) run(ctx context.Context, event Event) error {
+	delay := h.retryDelay
+	for attempt := 0; ; attempt++ {
+		tCtx, cancel := context.WithTimeout(ctx, h.timeout)
+		err := h.Interface.Run(tCtx, event)
+		cancel()
+
+		if err == nil {
+			metrics.HookRuns.WithLabelValues(h.name, "success").Inc()
+			return nil
+		}
+
+		metrics.HookRuns.WithLabelValues(h.name, "error").Inc()
+		if attempt >= h.retry {
+			return err
+		}
+
+		log.S(ctx).Warnw("hook failed, will retry", "attempt", attempt+1, "delay", delay, zap.Error(err))
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return err
+		}
+
+		delay *= 2
+	}
+}
+
+// New creates Hook from config.
+func New(ctx context.Context, c config.Hook) (*Hook, error) {
+	if c.Name == "" {
+		c.Name = c.Type
+	}
+
+	ctx = log.SWith(ctx, "hook", c.Name, "type", c.Type)
+
+	create, ok := Hooks[c.Type]
+	if !ok {
+		log.S(ctx).Errorw("unknown hook type")
+		return nil, fmt.Errorf("unknown hook type %q", c.Type)
+	}
+
+	if c.Retry < 0 {
+		log.S(ctx).Errorw("bad retry count", "retry", c.Retry)
+		return nil, fmt.Errorf("bad retry count %d", c.Retry)
+	}
+
+	if c.Timeout <= 0 {
+		c.Timeout = common.Duration(defaultTimeout)
+	}
+
+	if c.RetryDelay <= 0 {
+		c.RetryDelay = common.Duration(defaultRetryDelay)
+	}
+
+	hook, err := create(ctx, c)
+	if err != nil {
+		return nil, fmt.Errorf("failed creating hook %q: %w", c.Name, err)
+	}
+
+	return &Hook{
+		Interface:  hook,
+		name:       c.Name,
+		timeout:    time.Duration(c.Timeout),
+		retry:      c.Retry,
+		retryDelay: time.Duration(c.RetryDelay),
+	}, nil
+}
+
+// Dispatcher runs hooks in background, so that slow or broken hooks never block publishing.
+type Dispatcher struct {
+	wg sync.WaitGroup
+}
+
+// Dispatch starts running all hooks with event. Failures are only logged.
+func (d *Dispatcher) Dispatch(ctx context.Context, hooks []*Hook, event Event) {
+	// Hooks outlive the update that triggered them, they are bounded by timeout and retry instead.
+	ctx = context.WithoutCancel(ctx)
+
+	for _, hook := range hooks {
+		ctx := log.SWith(ctx, "hook", hook.name, "hook_type", hook.Typename(), "action", event.Action,
+			"domain", event.Domain, "ns_type", event.Type, "ip", event.NewIP, "old_ip", event.OldIP)
+
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+
+			if err := hook.run(ctx, event); err != nil {
+				log.S(ctx).Errorw("hook failed", zap.Error(err))
+				return
+			}
+
+			log.S(ctx).Infow("hook finished")
+		}()
+	}
+}
+
+// Wait blocks until all dispatched hooks finished.
+func (d *Dispatcher) Wait() {
+	d.wg.Wait()
+}
@@ -0,0 +1,125 @@
+package hooks
+
+import (
+	"bytes"
+	"cfddns/common"
+	"cfddns/config"
+	"cfddns/log"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+
+	"github.com/goccy/go-json"
+	"go.uber.org/zap"
+)
+
+const maxReadWebhook = 4 * 1024
+
+type webhook struct {
+	config.HookWebhookConfig `mapstructure:",squash"`
+
+	url  string
+	body *template.Template
+}
+
+func (h *webhook) Typename() string {
+	return "webhook"
+}
+
+// toJSON is used in body templates, to quote values as JSON.
+func toJSON(v any) (string, error) {
+	data, err := json.Marshal(v)
+	return string(data), err
+}
+
+func (h *webhook) payload(event Event) ([]byte, error) {
+	if h.body == nil {
+		return json.Marshal(event)
+	}
+
+	var buf bytes.Buffer
+	if err := h.body.Execute(&buf, event); err != nil {
+		return nil, fmt.Errorf("failed executing body template: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (h *webhook) Run(ctx context.Context, event Event) error {
+	client := http.DefaultClient
+	if ctxClient := ctx.Value(common.HttpClientKey); ctxClient != nil {
+		client = ctxClient.(*http.Client)
+	}
+
+	ctx = log.SWith(ctx, "url", h.url)
+
+	body, err := h.payload(event)
+	if err != nil {
+		log.S(ctx).Errorw("bad payload", zap.Error(err))
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, h.Method, h.url, bytes.NewReader(body))
+	if err != nil {
+		log.S(ctx).Errorw("new request failed", zap.Error(err))
+		return fmt.Errorf("new request failed: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range h.Headers {
+		if strings.EqualFold(k, "Host") {
+			req.Host = v
+		} else {
+			req.Header.Set(k, v)
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		log.S(ctx).Warnw("connection failed", zap.Error(err))
+		return fmt.Errorf("connection failed: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, maxReadWebhook))
+		log.S(ctx).Warnw("unexpected status", "status", resp.StatusCode, log.ByteField("body", data))
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	return nil
+}
+
+func newWebhook(ctx context.Context, hook config.Hook) (Interface, error) {
+	h := &webhook{url: hook.Target}
+	if err := common.WeakDecodeMap(hook.Config, h); err != nil {
+		log.S(ctx).Errorw("bad config", zap.Error(err), "config", hook.Config)
+		return nil, fmt.Errorf(`bad config: %w`, err)
+	}
+
+	if u, err := url.Parse(h.url); err != nil || u.Scheme != "http" && u.Scheme != "https" {
+		log.S(ctx).Errorw("bad url", "url", h.url, zap.Error(err))
+		return nil, fmt.Errorf("bad url %q", h.url)
+	}
+
+	if h.Method == "" {
+		h.Method = http.MethodPost
+	}
+
+	if h.Body != "" {
+		body, err := template.New("body").Funcs(template.FuncMap{"json": toJSON}).Parse(h.Body)
+		if err != nil {
+			log.S(ctx).Errorw("bad body template", zap.Error(err))
+			return nil, fmt.Errorf("bad body template: %w", err)
+		}
+
+		h.body = body
+	}
+
+	return h, nil
+}
@@ -19,6 +19,10 @@ func IP(ip net.IP) zap.Field {
 	return zap.Stringer("ip", ip)
 }
 
+func IPs(ips []net.IP) zap.Field {
+	return zap.Stringers("ips", ips)
+}
+
 func Stage(stage string) zap.Field {
 	return zap.String("stage", stage)
 }
@@ -0,0 +1,133 @@
+package metrics
+
+import (
+	"cfddns/log"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+)
+
+const namespace = "cfddns"
+
+var registry = prometheus.NewRegistry()
+
+var (
+	SourceLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "source_lookups_total",
+		Help:      "Number of IP lookups from sources.",
+	}, []string{"address", "source"})
+
+	SourceLookupFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "source_lookup_failures_total",
+		Help:      "Number of failed IP lookups from sources.",
+	}, []string{"address", "source"})
+
+	SourceLookupDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "source_lookup_duration_seconds",
+		Help:      "Time taken by IP lookups from sources.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"address", "source"})
+
+	AddressInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "address_info",
+		Help:      "Currently resolved IP of addresses, always 1.",
+	}, []string{"address", "ip"})
+
+	DomainUpdates = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "domain_updates_total",
+		Help:      "Number of record changes written.",
+	}, []string{"domain", "type", "mark"})
+
+	DomainUpdateFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "domain_update_failures_total",
+		Help:      "Number of failed record writes.",
+	}, []string{"domain", "type", "mark"})
+
+	DomainLastSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "domain_last_success_timestamp_seconds",
+		Help:      "Time when record is last confirmed up to date.",
+	}, []string{"domain", "type", "mark"})
+
+	HookRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "hook_runs_total",
+		Help:      "Number of hook runs, including retries.",
+	}, []string{"hook", "result"})
+
+	ProviderRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "provider_request_duration_seconds",
+		Help:      "Time taken by DNS provider API calls.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"provider", "action", "result"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		SourceLookups,
+		SourceLookupFailures,
+		SourceLookupDuration,
+		AddressInfo,
+		DomainUpdates,
+		DomainUpdateFailures,
+		DomainLastSuccess,
+		HookRuns,
+		ProviderRequestDuration,
+	)
+}
+
+// SetAddress records ips as the only resolved IP of address.
+func SetAddress(address string, ips []net.IP) {
+	AddressInfo.DeletePartialMatch(prometheus.Labels{"address": address})
+	for _, ip := range ips {
+		AddressInfo.WithLabelValues(address, ip.String()).Set(1)
+	}
+}
+
+// ObserveProvider records duration of a provider API call started at start.
+func ObserveProvider(provider, action string, start time.Time, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+
+	ProviderRequestDuration.WithLabelValues(provider, action, result).Observe(time.Since(start).Seconds())
+}
+
+// Serve exposes metrics over HTTP at addr, until ctx is done.
+func Serve(ctx context.Context, addr, path string) error {
+	ctx = log.SWith(ctx, log.Stage("metrics"), "listen", addr)
+
+	mux := http.NewServeMux()
+	mux.Handle(path, promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+
+	server := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		_ = server.Close()
+	}()
+
+	log.S(ctx).Infow("serving metrics", "path", path)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.S(ctx).Errorw("metrics server failed", zap.Error(err))
+		return err
+	}
+
+	return nil
+}
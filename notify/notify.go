@@ -0,0 +1,291 @@
+package notify
+
+import (
+	"cfddns/common"
+	"cfddns/config"
+	"cfddns/log"
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultFailures   = 3
+	defaultDedup      = time.Hour
+	defaultRateLimit  = 10
+	defaultRateWindow = time.Hour
+	defaultTimeout    = 10 * time.Second
+)
+
+type Interface interface {
+	Send(ctx context.Context, event Event) error
+	Typename() string
+}
+
+var Channels = map[string]func(ctx context.Context, channel config.NotifyChannel) (Interface, error){
+	"smtp":    newSMTP,
+	"ntfy":    newNtfy,
+	"gotify":  newGotify,
+	"webhook": newWebhook,
+}
+
+// Event is a notification sent to channels.
+type Event struct {
+	Kind    common.NotifyEvent `json:"kind"`
+	Node    string             `json:"node,omitempty"`
+	Subject string             `json:"subject"`
+	Title   string             `json:"title"`
+	Message string             `json:"message"`
+	Time    time.Time          `json:"time"`
+}
+
+type channel struct {
+	Interface
+
+	name    string
+	events  []common.NotifyEvent
+	timeout time.Duration
+
+	mu     sync.Mutex
+	sent   map[string]time.Time
+	recent []time.Time
+}
+
+// allow reports whether an event with key can be sent now, and records it as sent if so.
+// Events with the same key are sent at most once within dedup, and at most limit events are
+// sent within window.
+func (c *channel) allow(key string, now time.Time, dedup, window time.Duration, limit int) (bool, string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Drop expired entries, so keys of events that won't recur, like addresses changed to old IPs,
+	// don't pile up.
+	maps.DeleteFunc(c.sent, func(_ string, t time.Time) bool {
+		return now.Sub(t) >= dedup
+	})
+
+	c.recent = slices.DeleteFunc(c.recent, func(t time.Time) bool {
+		return now.Sub(t) >= window
+	})
+
+	if _, exist := c.sent[key]; exist {
+		return false, "duplicated"
+	}
+
+	if len(c.recent) >= limit {
+		return false, "rate limited"
+	}
+
+	c.sent[key] = now
+	c.recent = append(c.recent, now)
+	return true, ""
+}
+
+// Notifier turns resolve and publish results into events, and sends them to channels in background.
+// A nil Notifier sends nothing.
+type Notifier struct {
+	node       string
+	channels   []*channel
+	failures   int
+	dedup      time.Duration
+	rateLimit  int
+	rateWindow time.Duration
+
+	mu      sync.Mutex
+	counts  map[string]int
+	alerted map[string]bool
+	// outages numbers notified outages of each subject, so alerts of a new outage are not taken as
+	// duplicates of the last one.
+	outages map[string]int
+
+	wg sync.WaitGroup
+}
+
+func (n *Notifier) send(ctx context.Context, key string, event Event) {
+	// Notifications outlive the cycle that triggered them, they are bounded by timeout instead.
+	ctx = context.WithoutCancel(ctx)
+	ctx = log.SWith(ctx, "event", event.Kind, "subject", event.Subject)
+
+	event.Node = n.node
+	event.Time = time.Now()
+	if n.node != "" {
+		event.Title = "[" + n.node + "] " + event.Title
+	}
+
+	for _, c := range n.channels {
+		if len(c.events) != 0 && !slices.Contains(c.events, event.Kind) {
+			continue
+		}
+
+		ctx := log.SWith(ctx, "channel", c.name, "channel_type", c.Typename())
+		if ok, reason := c.allow(key, event.Time, n.dedup, n.rateWindow, n.rateLimit); !ok {
+			log.S(ctx).Infow("notification suppressed", "reason", reason)
+			continue
+		}
+
+		n.wg.Add(1)
+		go func() {
+			defer n.wg.Done()
+
+			tCtx, cancel := context.WithTimeout(ctx, c.timeout)
+			defer cancel()
+
+			if err := c.Send(tCtx, event); err != nil {
+				log.S(ctx).Errorw("failed sending notification", zap.Error(err))
+				return
+			}
+
+			log.S(ctx).Infow("notification sent")
+		}()
+	}
+}
+
+// IPChanged notifies that address is resolved to ips, which is different from old.
+func (n *Notifier) IPChanged(ctx context.Context, address string, old, ips []string) {
+	if n == nil {
+		return
+	}
+
+	subject := fmt.Sprintf("address %q", address)
+	n.send(ctx, "ip_changed "+subject+" "+strings.Join(ips, ","), Event{
+		Kind:    common.EventIPChanged,
+		Subject: subject,
+		Title:   fmt.Sprintf("IP of %s changed", address),
+		Message: fmt.Sprintf("IP of %s changed from %s to %s.", subject, strings.Join(old, ", "), strings.Join(ips, ", ")),
+	})
+}
+
+// Failed records a failure of subject. Event of kind is sent once failures in a row reach threshold.
+func (n *Notifier) Failed(ctx context.Context, kind common.NotifyEvent, subject string, err error) {
+	if n == nil {
+		return
+	}
+
+	n.mu.Lock()
+	n.counts[subject]++
+	count := n.counts[subject]
+	notify := count == n.failures
+	if notify {
+		n.alerted[subject] = true
+		n.outages[subject]++
+	}
+	outage := n.outages[subject]
+	n.mu.Unlock()
+
+	if !notify {
+		return
+	}
+
+	n.send(ctx, fmt.Sprintf("%s %s #%d", kind, subject, outage), Event{
+		Kind:    kind,
+		Subject: subject,
+		Title:   fmt.Sprintf("%s failing", subject),
+		Message: fmt.Sprintf("%s failed %d times in a row: %v", subject, count, err),
+	})
+}
+
+// Succeeded records a success of subject. Recovered event is sent if its failure was notified.
+func (n *Notifier) Succeeded(ctx context.Context, subject string) {
+	if n == nil {
+		return
+	}
+
+	n.mu.Lock()
+	delete(n.counts, subject)
+	notify := n.alerted[subject]
+	delete(n.alerted, subject)
+	outage := n.outages[subject]
+	n.mu.Unlock()
+
+	if !notify {
+		return
+	}
+
+	n.send(ctx, fmt.Sprintf("recovered %s #%d", subject, outage), Event{
+		Kind:    common.EventRecovered,
+		Subject: subject,
+		Title:   fmt.Sprintf("%s recovered", subject),
+		Message: fmt.Sprintf("%s is working again.", subject),
+	})
+}
+
+// Wait blocks until all notifications being sent are finished.
+func (n *Notifier) Wait() {
+	if n == nil {
+		return
+	}
+
+	n.wg.Wait()
+}
+
+// New creates Notifier from config. node is included in events to tell instances apart.
+func New(ctx context.Context, c config.Notify, node string) (*Notifier, error) {
+	ctx = log.SWith(ctx, log.Stage("init:notify"))
+
+	n := &Notifier{
+		node:       node,
+		failures:   c.Failures,
+		dedup:      time.Duration(c.Dedup),
+		rateLimit:  c.RateLimit,
+		rateWindow: time.Duration(c.RateWindow),
+		counts:     map[string]int{},
+		alerted:    map[string]bool{},
+		outages:    map[string]int{},
+	}
+
+	if n.failures <= 0 {
+		n.failures = defaultFailures
+	}
+
+	if n.dedup <= 0 {
+		n.dedup = defaultDedup
+	}
+
+	if n.rateLimit <= 0 {
+		n.rateLimit = defaultRateLimit
+	}
+
+	if n.rateWindow <= 0 {
+		n.rateWindow = defaultRateWindow
+	}
+
+	for _, cc := range c.Channels {
+		if cc.Name == "" {
+			cc.Name = cc.Type
+		}
+
+		ctx := log.SWith(ctx, "channel", cc.Name, "type", cc.Type)
+
+		create, ok := Channels[cc.Type]
+		if !ok {
+			log.S(ctx).Errorw("unknown channel type")
+			return nil, fmt.Errorf("unknown channel type %q", cc.Type)
+		}
+
+		ch, err := create(ctx, cc)
+		if err != nil {
+			return nil, fmt.Errorf("failed creating channel %q: %w", cc.Name, err)
+		}
+
+		timeout := time.Duration(cc.Timeout)
+		if timeout <= 0 {
+			timeout = defaultTimeout
+		}
+
+		n.channels = append(n.channels, &channel{
+			Interface: ch,
+			name:      cc.Name,
+			events:    cc.Events,
+			timeout:   timeout,
+			sent:      map[string]time.Time{},
+		})
+	}
+
+	return n, nil
+}
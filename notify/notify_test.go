@@ -0,0 +1,375 @@
+package notify
+
+import (
+	"cfddns/common"
+	"cfddns/config"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testEvent = Event{
+	Kind:    common.EventIPChanged,
+	Subject: `address "home"`,
+	Title:   "IP of home changed",
+	Message: "IP of home changed\nto 192.0.2.1.",
+	Time:    time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+}
+
+type httpRequest struct {
+	method string
+	path   string
+	header http.Header
+	body   string
+}
+
+// newHTTPServer starts a server replying status, and sends requests it got to the returned channel.
+func newHTTPServer(t *testing.T, status int) (*httptest.Server, chan httpRequest) {
+	t.Helper()
+
+	requests := make(chan httpRequest, 1)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- httpRequest{method: r.Method, path: r.URL.Path, header: r.Header, body: string(body)}
+		w.WriteHeader(status)
+	}))
+
+	t.Cleanup(s.Close)
+	return s, requests
+}
+
+func TestHTTPChannels(t *testing.T) {
+	tests := []struct {
+		name    string
+		channel config.NotifyChannel
+		path    string
+		status  int
+		check   func(t *testing.T, r httpRequest)
+		wantErr bool
+	}{
+		{
+			name:    "ntfy",
+			channel: config.NotifyChannel{Type: "ntfy", Target: "/topic", Config: map[string]any{"token": "tk", "priority": 4, "tags": []any{"a", "b"}}},
+			path:    "/topic",
+			check: func(t *testing.T, r httpRequest) {
+				expectHeader(t, r, "Title", testEvent.Title)
+				expectHeader(t, r, "Authorization", "Bearer tk")
+				expectHeader(t, r, "Priority", "4")
+				expectHeader(t, r, "Tags", "a,b")
+				expectBody(t, r, testEvent.Message)
+			},
+		},
+		{
+			name:    "gotify",
+			channel: config.NotifyChannel{Type: "gotify", Target: "/", Config: map[string]any{"token": "tk", "priority": 5}},
+			path:    "/message",
+			check: func(t *testing.T, r httpRequest) {
+				expectHeader(t, r, "X-Gotify-Key", "tk")
+				expectBody(t, r, `{"message":"IP of home changed\nto 192.0.2.1.","priority":5,"title":"IP of home changed"}`)
+			},
+		},
+		{
+			name:    "webhook",
+			channel: config.NotifyChannel{Type: "webhook", Target: "/hook"},
+			path:    "/hook",
+			check: func(t *testing.T, r httpRequest) {
+				expectHeader(t, r, "Content-Type", "application/json")
+				expectBody(t, r, `{"kind":"ip_changed","subject":"address \"home\"","title":"IP of home changed","message":"IP of home changed\nto 192.0.2.1.","time":"2024-01-02T03:04:05Z"}`)
+			},
+		},
+		{
+			name: "webhook template",
+			channel: config.NotifyChannel{Type: "webhook", Target: "/hook", Config: map[string]any{
+				"method":  "PUT",
+				"headers": map[string]any{"x-token": "tk"},
+				"body":    `{"text": {{json .Subject}}}`,
+			}},
+			path: "/hook",
+			check: func(t *testing.T, r httpRequest) {
+				if r.method != http.MethodPut {
+					t.Errorf("method = %s, want PUT", r.method)
+				}
+
+				expectHeader(t, r, "X-Token", "tk")
+				expectBody(t, r, `{"text": "address \"home\""}`)
+			},
+		},
+		{
+			name:    "error status",
+			channel: config.NotifyChannel{Type: "ntfy", Target: "/topic"},
+			path:    "/topic",
+			status:  http.StatusForbidden,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := tt.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			s, requests := newHTTPServer(t, status)
+
+			tt.channel.Target = s.URL + tt.channel.Target
+			c, err := Channels[tt.channel.Type](context.Background(), tt.channel)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = c.Send(context.Background(), testEvent)
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+
+			r := <-requests
+			if r.path != tt.path {
+				t.Errorf("path = %s, want %s", r.path, tt.path)
+			}
+
+			if tt.check != nil {
+				tt.check(t, r)
+			}
+		})
+	}
+}
+
+func expectHeader(t *testing.T, r httpRequest, key, want string) {
+	t.Helper()
+
+	if got := r.header.Get(key); got != want {
+		t.Errorf("header %s = %q, want %q", key, got, want)
+	}
+}
+
+func expectBody(t *testing.T, r httpRequest, want string) {
+	t.Helper()
+
+	if r.body != want {
+		t.Errorf("body = %s, want %s", r.body, want)
+	}
+}
+
+type smtpMail struct {
+	from string
+	to   []string
+	data string
+}
+
+// newSMTPServer starts a plain SMTP server, accepting one message. Recipients containing
+// "reject" are rejected.
+func newSMTPServer(t *testing.T) (string, chan smtpMail) {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { _ = l.Close() })
+
+	mails := make(chan smtpMail, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+
+		c := textproto.NewConn(conn)
+		defer c.Close()
+
+		var mail smtpMail
+		_ = c.PrintfLine("220 localhost ESMTP")
+		for {
+			line, err := c.ReadLine()
+			if err != nil {
+				return
+			}
+
+			verb, arg, _ := strings.Cut(line, " ")
+			switch strings.ToUpper(verb) {
+			case "EHLO", "HELO":
+				_ = c.PrintfLine("250 localhost")
+			case "MAIL":
+				mail.from = arg
+				_ = c.PrintfLine("250 OK")
+			case "RCPT":
+				if strings.Contains(arg, "reject") {
+					_ = c.PrintfLine("550 no such user")
+					continue
+				}
+
+				mail.to = append(mail.to, arg)
+				_ = c.PrintfLine("250 OK")
+			case "DATA":
+				_ = c.PrintfLine("354 go ahead")
+				data, err := c.ReadDotBytes()
+				if err != nil {
+					return
+				}
+
+				mail.data = string(data)
+				_ = c.PrintfLine("250 OK")
+				mails <- mail
+			case "QUIT":
+				_ = c.PrintfLine("221 bye")
+				return
+			default:
+				_ = c.PrintfLine("502 not implemented")
+			}
+		}
+	}()
+
+	return l.Addr().String(), mails
+}
+
+func TestSMTP(t *testing.T) {
+	tests := []struct {
+		name    string
+		to      []any
+		wantErr bool
+	}{
+		{name: "sent", to: []any{"a@example.com", "b@example.com"}},
+		{name: "recipient rejected", to: []any{"a@example.com", "reject@example.com"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, mails := newSMTPServer(t)
+
+			c, err := newSMTP(context.Background(), config.NotifyChannel{Type: "smtp", Target: addr, Config: map[string]any{
+				"from": "ddns@example.com",
+				"to":   tt.to,
+				"tls":  "none",
+			}})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			err = c.Send(ctx, testEvent)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("want error")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			mail := <-mails
+			if mail.from != "FROM:<ddns@example.com>" {
+				t.Errorf("from = %s", mail.from)
+			}
+
+			if strings.Join(mail.to, ",") != "TO:<a@example.com>,TO:<b@example.com>" {
+				t.Errorf("to = %v", mail.to)
+			}
+
+			for _, want := range []string{
+				"From: ddns@example.com\n",
+				"To: a@example.com, b@example.com\n",
+				"Subject: IP of home changed\n",
+				"\nIP of home changed\nto 192.0.2.1.\n",
+			} {
+				if !strings.Contains(mail.data, want) {
+					t.Errorf("message missing %q:\n%s", want, mail.data)
+				}
+			}
+		})
+	}
+}
+
+func TestChannelAllow(t *testing.T) {
+	c := &channel{sent: map[string]time.Time{}}
+	start := time.Now()
+
+	steps := []struct {
+		key    string
+		after  time.Duration
+		want   bool
+		reason string
+	}{
+		{key: "a", after: 0, want: true},
+		{key: "a", after: time.Minute, want: false, reason: "duplicated"},
+		{key: "b", after: time.Minute, want: true},
+		{key: "c", after: 2 * time.Minute, want: false, reason: "rate limited"},
+		{key: "a", after: 11 * time.Minute, want: true},
+		{key: "c", after: 12 * time.Minute, want: true},
+	}
+
+	for _, step := range steps {
+		ok, reason := c.allow(step.key, start.Add(step.after), 10*time.Minute, 10*time.Minute, 2)
+		if ok != step.want || reason != step.reason {
+			t.Errorf("%s after %s: allow = %v %q, want %v %q", step.key, step.after, ok, reason, step.want, step.reason)
+		}
+	}
+
+	// b is expired and pruned, a and c are sent within dedup.
+	if len(c.sent) != 2 {
+		t.Errorf("sent = %v, want expired keys pruned", c.sent)
+	}
+}
+
+// recorder keeps events sent to it.
+type recorder struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (r *recorder) Typename() string {
+	return "recorder"
+}
+
+func (r *recorder) Send(ctx context.Context, event Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.events = append(r.events, event)
+	return nil
+}
+
+// A new outage within dedup is alerted again, as its recovery is.
+func TestNotifierOutages(t *testing.T) {
+	ctx := context.Background()
+	n, err := New(ctx, config.Notify{Failures: 2, Channels: []config.NotifyChannel{{Type: "webhook", Target: "http://127.0.0.1/"}}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := &recorder{}
+	n.channels[0].Interface = r
+
+	fail := errors.New("failed")
+	for range 2 {
+		n.Failed(ctx, common.EventPublishFailed, "domain", fail)
+		n.Failed(ctx, common.EventPublishFailed, "domain", fail)
+		n.Failed(ctx, common.EventPublishFailed, "domain", fail)
+		n.Wait()
+		n.Succeeded(ctx, "domain")
+		n.Wait()
+	}
+
+	var kinds []string
+	for _, event := range r.events {
+		kinds = append(kinds, event.Kind.String())
+	}
+
+	want := "publish_failed,recovered,publish_failed,recovered"
+	if got := strings.Join(kinds, ","); got != want {
+		t.Errorf("events = %s, want %s", got, want)
+	}
+}
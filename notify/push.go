@@ -0,0 +1,160 @@
+package notify
+
+import (
+	"bytes"
+	"cfddns/common"
+	"cfddns/config"
+	"cfddns/log"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/goccy/go-json"
+	"go.uber.org/zap"
+)
+
+const maxReadResponse = 4 * 1024
+
+// post sends body to url with headers, and checks for 2xx status.
+func post(ctx context.Context, url string, headers map[string]string, body []byte) error {
+	return request(ctx, http.MethodPost, url, headers, body)
+}
+
+func request(ctx context.Context, method, url string, headers map[string]string, body []byte) error {
+	client := http.DefaultClient
+	if ctxClient := ctx.Value(common.HttpClientKey); ctxClient != nil {
+		client = ctxClient.(*http.Client)
+	}
+
+	ctx = log.SWith(ctx, "url", url)
+
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		log.S(ctx).Errorw("new request failed", zap.Error(err))
+		return fmt.Errorf("new request failed: %w", err)
+	}
+
+	for k, v := range headers {
+		if strings.EqualFold(k, "Host") {
+			req.Host = v
+		} else {
+			req.Header.Set(k, v)
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		log.S(ctx).Warnw("connection failed", zap.Error(err))
+		return fmt.Errorf("connection failed: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, maxReadResponse))
+		log.S(ctx).Warnw("unexpected status", "status", resp.StatusCode, log.ByteField("body", data))
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	return nil
+}
+
+func checkURL(ctx context.Context, target string) error {
+	if u, err := url.Parse(target); err != nil || u.Scheme != "http" && u.Scheme != "https" {
+		log.S(ctx).Errorw("bad url", "url", target, zap.Error(err))
+		return fmt.Errorf("bad url %q", target)
+	}
+
+	return nil
+}
+
+// ntfy publishes to a ntfy topic, like https://ntfy.sh/mytopic.
+type ntfy struct {
+	config.NotifyPushConfig `mapstructure:",squash"`
+
+	url string
+}
+
+func (c *ntfy) Typename() string {
+	return "ntfy"
+}
+
+func (c *ntfy) Send(ctx context.Context, event Event) error {
+	headers := map[string]string{"Title": event.Title}
+	if c.Token != "" {
+		headers["Authorization"] = "Bearer " + c.Token
+	}
+
+	if c.Priority != 0 {
+		headers["Priority"] = strconv.Itoa(c.Priority)
+	}
+
+	if len(c.Tags) != 0 {
+		headers["Tags"] = strings.Join(c.Tags, ",")
+	}
+
+	return post(ctx, c.url, headers, []byte(event.Message))
+}
+
+func newNtfy(ctx context.Context, channel config.NotifyChannel) (Interface, error) {
+	c := &ntfy{url: channel.Target}
+	if err := common.WeakDecodeMap(channel.Config, c); err != nil {
+		log.S(ctx).Errorw("bad config", zap.Error(err), "config", channel.Config)
+		return nil, fmt.Errorf(`bad config: %w`, err)
+	}
+
+	if err := checkURL(ctx, c.url); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// gotify posts to /message of a gotify server, like https://gotify.example.com.
+type gotify struct {
+	config.NotifyPushConfig `mapstructure:",squash"`
+
+	url string
+}
+
+func (c *gotify) Typename() string {
+	return "gotify"
+}
+
+func (c *gotify) Send(ctx context.Context, event Event) error {
+	body, err := json.Marshal(map[string]any{
+		"title":    event.Title,
+		"message":  event.Message,
+		"priority": c.Priority,
+	})
+	if err != nil {
+		return err
+	}
+
+	headers := map[string]string{"Content-Type": "application/json", "X-Gotify-Key": c.Token}
+	return post(ctx, c.url, headers, body)
+}
+
+func newGotify(ctx context.Context, channel config.NotifyChannel) (Interface, error) {
+	c := &gotify{}
+	if err := common.WeakDecodeMap(channel.Config, c); err != nil {
+		log.S(ctx).Errorw("bad config", zap.Error(err), "config", channel.Config)
+		return nil, fmt.Errorf(`bad config: %w`, err)
+	}
+
+	if err := checkURL(ctx, channel.Target); err != nil {
+		return nil, err
+	}
+
+	if c.Token == "" {
+		log.S(ctx).Errorw("token not set")
+		return nil, fmt.Errorf("token not set")
+	}
+
+	c.url = strings.TrimSuffix(channel.Target, "/") + "/message"
+	return c, nil
+}
@@ -0,0 +1,146 @@
+package notify
+
+import (
+	"bytes"
+	"cfddns/common"
+	"cfddns/config"
+	"cfddns/log"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type smtpChannel struct {
+	config.NotifySMTPConfig `mapstructure:",squash"`
+
+	addr string
+	host string
+}
+
+func (c *smtpChannel) Typename() string {
+	return "smtp"
+}
+
+func (c *smtpChannel) message(event Event) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", c.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(c.To, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", event.Title))
+	fmt.Fprintf(&buf, "Date: %s\r\n", event.Time.Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(strings.ReplaceAll(event.Message, "\n", "\r\n"))
+	buf.WriteString("\r\n")
+	return buf.Bytes()
+}
+
+func (c *smtpChannel) Send(ctx context.Context, event Event) (err error) {
+	ctx = log.SWith(ctx, "server", c.addr)
+
+	var conn net.Conn
+	if c.TLS == "tls" {
+		dialer := &tls.Dialer{Config: &tls.Config{ServerName: c.host}}
+		conn, err = dialer.DialContext(ctx, "tcp", c.addr)
+	} else {
+		conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", c.addr)
+	}
+
+	if err != nil {
+		log.S(ctx).Warnw("connection failed", zap.Error(err))
+		return fmt.Errorf("connection failed: %w", err)
+	}
+
+	// net/smtp doesn't support context, rely on deadline instead.
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, c.host)
+	if err != nil {
+		_ = conn.Close()
+		return fmt.Errorf("smtp handshake failed: %w", err)
+	}
+
+	defer client.Close()
+
+	if c.TLS == "starttls" {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("server doesn't support STARTTLS")
+		}
+
+		if err := client.StartTLS(&tls.Config{ServerName: c.host}); err != nil {
+			return fmt.Errorf("starttls failed: %w", err)
+		}
+	}
+
+	if c.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", c.Username, c.Password, c.host)); err != nil {
+			return fmt.Errorf("auth failed: %w", err)
+		}
+	}
+
+	if err := client.Mail(c.From); err != nil {
+		return fmt.Errorf("sender rejected: %w", err)
+	}
+
+	for _, to := range c.To {
+		if err := client.Rcpt(to); err != nil {
+			return fmt.Errorf("recipient %s rejected: %w", to, err)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("data rejected: %w", err)
+	}
+
+	if _, err := w.Write(c.message(event)); err != nil {
+		return fmt.Errorf("failed writing message: %w", err)
+	}
+
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("message rejected: %w", err)
+	}
+
+	return client.Quit()
+}
+
+func newSMTP(ctx context.Context, channel config.NotifyChannel) (Interface, error) {
+	c := &smtpChannel{addr: channel.Target}
+	if err := common.WeakDecodeMap(channel.Config, c); err != nil {
+		log.S(ctx).Errorw("bad config", zap.Error(err), "config", channel.Config)
+		return nil, fmt.Errorf(`bad config: %w`, err)
+	}
+
+	host, _, err := net.SplitHostPort(c.addr)
+	if err != nil {
+		log.S(ctx).Errorw("bad server address", "server", c.addr, zap.Error(err))
+		return nil, fmt.Errorf("bad server address: %w", err)
+	}
+
+	c.host = host
+
+	switch c.TLS {
+	case "":
+		c.TLS = "starttls"
+	case "starttls", "tls", "none":
+	default:
+		log.S(ctx).Errorw("bad tls mode", "tls", c.TLS)
+		return nil, fmt.Errorf("bad tls mode %q", c.TLS)
+	}
+
+	if c.From == "" || len(c.To) == 0 {
+		log.S(ctx).Errorw("from and to must be set")
+		return nil, fmt.Errorf("from and to must be set")
+	}
+
+	return c, nil
+}
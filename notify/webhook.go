@@ -0,0 +1,87 @@
+package notify
+
+import (
+	"bytes"
+	"cfddns/common"
+	"cfddns/config"
+	"cfddns/log"
+	"context"
+	"fmt"
+	"net/http"
+	"text/template"
+
+	"github.com/goccy/go-json"
+	"go.uber.org/zap"
+)
+
+type webhook struct {
+	config.NotifyWebhookConfig `mapstructure:",squash"`
+
+	url     string
+	headers map[string]string
+	body    *template.Template
+}
+
+func (c *webhook) Typename() string {
+	return "webhook"
+}
+
+// toJSON is used in body templates, to quote values as JSON.
+func toJSON(v any) (string, error) {
+	data, err := json.Marshal(v)
+	return string(data), err
+}
+
+func (c *webhook) Send(ctx context.Context, event Event) error {
+	var body []byte
+	if c.body == nil {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+
+		body = data
+	} else {
+		var buf bytes.Buffer
+		if err := c.body.Execute(&buf, event); err != nil {
+			return fmt.Errorf("failed executing body template: %w", err)
+		}
+
+		body = buf.Bytes()
+	}
+
+	return request(ctx, c.Method, c.url, c.headers, body)
+}
+
+func newWebhook(ctx context.Context, channel config.NotifyChannel) (Interface, error) {
+	c := &webhook{url: channel.Target}
+	if err := common.WeakDecodeMap(channel.Config, c); err != nil {
+		log.S(ctx).Errorw("bad config", zap.Error(err), "config", channel.Config)
+		return nil, fmt.Errorf(`bad config: %w`, err)
+	}
+
+	if err := checkURL(ctx, c.url); err != nil {
+		return nil, err
+	}
+
+	if c.Method == "" {
+		c.Method = http.MethodPost
+	}
+
+	c.headers = map[string]string{"Content-Type": "application/json"}
+	for k, v := range c.Headers {
+		c.headers[http.CanonicalHeaderKey(k)] = v
+	}
+
+	if c.Body != "" {
+		body, err := template.New("body").Funcs(template.FuncMap{"json": toJSON}).Parse(c.Body)
+		if err != nil {
+			log.S(ctx).Errorw("bad body template", zap.Error(err))
+			return nil, fmt.Errorf("bad body template: %w", err)
+		}
+
+		c.body = body
+	}
+
+	return c, nil
+}
@@ -29,6 +29,14 @@ func (s *cloudflareTrace) Typename() string {
 	return "cf-trace"
 }
 
+func (s *cloudflareTrace) Family() (common.Family, bool) {
+	if s.Type == nil {
+		return 0, false
+	}
+
+	return *s.Type, true
+}
+
 func (s *cloudflareTrace) wrapDialer(upstream transportDialer) transportDialer {
 	return func(ctx context.Context, network, addr string) (net.Conn, error) {
 		if s.ForceAddress != "" {
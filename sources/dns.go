@@ -0,0 +1,243 @@
+package sources
+
+import (
+	"cfddns/common"
+	"cfddns/config"
+	"cfddns/log"
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"go.uber.org/zap"
+)
+
+const defaultDNSTimeout = 5 * time.Second
+
+type dnsPreset struct {
+	server4, server6 string
+	queryType        string
+	class            string
+}
+
+// dnsPresets are well known names that reply with IP of the querier, when asked to their
+// authoritative servers.
+var dnsPresets = map[string]dnsPreset{
+	"myip.opendns.com":        {server4: "resolver1.opendns.com", server6: "resolver1.ipv6-sandbox.opendns.com"},
+	"o-o.myaddr.l.google.com": {server4: "ns1.google.com", server6: "ns1.google.com", queryType: "TXT"},
+	"whoami.cloudflare":       {server4: "1.1.1.1", server6: "2606:4700:4700::1111", queryType: "TXT", class: "CH"},
+}
+
+type dnsQuery struct {
+	config.IPSourceDNSConfig `mapstructure:",squash"`
+
+	name      string
+	queryType uint16
+	class     uint16
+}
+
+func (s *dnsQuery) Typename() string {
+	return "dns"
+}
+
+func (s *dnsQuery) Family() (common.Family, bool) {
+	switch {
+	case s.Type != nil:
+		return *s.Type, true
+	case s.queryType == dns.TypeA:
+		return common.IPv4, true
+	case s.queryType == dns.TypeAAAA:
+		return common.IPv6, true
+	default:
+		return 0, false
+	}
+}
+
+// parse extracts IP from an answer record. TXT records not containing an IP are ignored,
+// as some servers reply with extra information in them.
+func (s *dnsQuery) parse(rr dns.RR) (netip.Addr, bool) {
+	switch rr := rr.(type) {
+	case *dns.A:
+		if s.queryType == dns.TypeA {
+			return netip.AddrFromSlice(rr.A.To4())
+		}
+	case *dns.AAAA:
+		if s.queryType == dns.TypeAAAA {
+			return netip.AddrFromSlice(rr.AAAA.To16())
+		}
+	case *dns.TXT:
+		if s.queryType == dns.TypeTXT {
+			nip, err := netip.ParseAddr(strings.TrimSpace(strings.Join(rr.Txt, "")))
+			return nip, err == nil
+		}
+	}
+
+	return netip.Addr{}, false
+}
+
+func (s *dnsQuery) Lookup(ctx context.Context) (result net.IP, err error) {
+	network := s.Network
+	switch {
+	case s.Type == nil:
+		// pass
+	case *s.Type == common.IPv4:
+		network += "4"
+	case *s.Type == common.IPv6:
+		network += "6"
+	}
+
+	server := net.JoinHostPort(s.Server, strconv.Itoa(s.Port))
+
+	ctx = log.SWith(ctx,
+		"name", s.name,
+		"server", server,
+		"network", network,
+		"query_type", dns.TypeToString[s.queryType],
+		"class", dns.ClassToString[s.class])
+
+	defer func() {
+		if err == nil {
+			log.S(ctx).Debugw("got ip", log.IP(result))
+		}
+	}()
+
+	msg := new(dns.Msg)
+	msg.SetQuestion(s.name, s.queryType)
+	msg.Question[0].Qclass = s.class
+
+	client := &dns.Client{Net: network, Timeout: time.Duration(s.Timeout)}
+	resp, _, err := client.ExchangeContext(ctx, msg, server)
+	if err != nil {
+		log.S(ctx).Warnw("query failed", zap.Error(err))
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+
+	if resp.Rcode != dns.RcodeSuccess {
+		log.S(ctx).Warnw("query rejected", "rcode", dns.RcodeToString[resp.Rcode])
+		return nil, fmt.Errorf("query rejected: %s", dns.RcodeToString[resp.Rcode])
+	}
+
+	for _, rr := range resp.Answer {
+		nip, ok := s.parse(rr)
+		if !ok {
+			continue
+		}
+
+		switch {
+		case nip.Zone() != "":
+			log.S(ctx).Warnw("found zone in IP", "ip", nip, "zone", nip.Zone())
+			return nil, fmt.Errorf(`unsupported: found zone in IP`)
+
+		case nip.Is4() || nip.Is4In6():
+			if s.Type == nil || *s.Type == common.IPv4 {
+				ip := nip.Unmap().As4()
+				return ip[:], nil
+			}
+
+		default:
+			if s.Type == nil || *s.Type == common.IPv6 {
+				ip := nip.As16()
+				return ip[:], nil
+			}
+		}
+
+		log.S(ctx).Debugw("ignore IP of mismatched family", "ip", nip)
+	}
+
+	log.S(ctx).Warnw("no IP found in response", "answer", resp.Answer)
+	return nil, fmt.Errorf("no IP found in response")
+}
+
+func newDNS(ctx context.Context, config config.IPSource) (Interface, error) {
+	ctx = log.SWith(ctx, "type", "dns")
+
+	s := &dnsQuery{name: dns.Fqdn(strings.ToLower(config.Source))}
+
+	if err := common.WeakDecodeMap(config.Config, s); err != nil {
+		log.S(ctx).Errorw("bad config", zap.Error(err), "config", config.Config)
+		return nil, fmt.Errorf(`bad config: %w`, err)
+	}
+
+	if _, ok := dns.IsDomainName(s.name); !ok {
+		log.S(ctx).Errorw("bad query name", "name", config.Source)
+		return nil, fmt.Errorf("bad query name %q", config.Source)
+	}
+
+	preset := dnsPresets[strings.TrimSuffix(s.name, ".")]
+
+	if s.Server == "" {
+		s.Server = preset.server4
+		if s.Type != nil && *s.Type == common.IPv6 {
+			s.Server = preset.server6
+		}
+	}
+
+	if s.Server == "" {
+		log.S(ctx).Errorw("server must be set for non-preset name", "name", config.Source)
+		return nil, fmt.Errorf("server not set")
+	}
+
+	s.Server, _ = common.DetectNormalizeAddr(s.Server)
+
+	if s.Port == 0 {
+		s.Port = 53
+	}
+
+	if s.Network == "" {
+		s.Network = "udp"
+	}
+
+	if s.Network != "udp" && s.Network != "tcp" {
+		log.S(ctx).Errorw("bad network", "network", s.Network)
+		return nil, fmt.Errorf("bad network %q", s.Network)
+	}
+
+	if s.Timeout == 0 {
+		s.Timeout = common.Duration(defaultDNSTimeout)
+	}
+
+	if s.QueryType == "" {
+		s.QueryType = preset.queryType
+	}
+
+	switch strings.ToUpper(s.QueryType) {
+	case "":
+		s.queryType = dns.TypeA
+		if s.Type != nil && *s.Type == common.IPv6 {
+			s.queryType = dns.TypeAAAA
+		}
+	case "A":
+		s.queryType = dns.TypeA
+	case "AAAA":
+		s.queryType = dns.TypeAAAA
+	case "TXT":
+		s.queryType = dns.TypeTXT
+	default:
+		log.S(ctx).Errorw("unsupported query type", "query_type", s.QueryType)
+		return nil, fmt.Errorf("unsupported query type %q", s.QueryType)
+	}
+
+	if s.Class == "" {
+		s.Class = preset.class
+	}
+
+	if s.Class == "" {
+		s.class = dns.ClassINET
+	} else if class, ok := dns.StringToClass[strings.ToUpper(s.Class)]; ok {
+		s.class = class
+	} else {
+		log.S(ctx).Errorw("unknown record class", "class", s.Class)
+		return nil, fmt.Errorf("unknown record class %q", s.Class)
+	}
+
+	if s.Type != nil && (s.queryType == dns.TypeA && *s.Type != common.IPv4 || s.queryType == dns.TypeAAAA && *s.Type != common.IPv6) {
+		log.S(ctx).Errorw("query type mismatch with family", "query_type", s.QueryType, "family", s.Type)
+		return nil, fmt.Errorf("query type %s mismatch with family %s", s.QueryType, s.Type)
+	}
+
+	return s, nil
+}
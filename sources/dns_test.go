@@ -0,0 +1,121 @@
+package sources
+
+import (
+	"cfddns/config"
+	"context"
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// newDNSStub serves answers by question name over UDP, and returns its port.
+func newDNSStub(t *testing.T, answers map[string][]string) int {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := &dns.Server{PacketConn: conn, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+
+		rrs, ok := answers[r.Question[0].Name]
+		if !ok {
+			m.Rcode = dns.RcodeNameError
+		}
+
+		for _, s := range rrs {
+			rr, err := dns.NewRR(s)
+			if err != nil {
+				t.Errorf("bad answer %q: %v", s, err)
+				continue
+			}
+
+			m.Answer = append(m.Answer, rr)
+		}
+
+		_ = w.WriteMsg(m)
+	})}
+
+	go func() {
+		_ = server.ActivateAndServe()
+	}()
+
+	t.Cleanup(func() {
+		_ = server.Shutdown()
+	})
+
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+func TestDNSLookup(t *testing.T) {
+	port := newDNSStub(t, map[string][]string{
+		"myip.example.":   {"myip.example. 0 IN A 192.0.2.1"},
+		"myip6.example.":  {"myip6.example. 0 IN AAAA 2001:db8::1"},
+		"txt.example.":    {`txt.example. 0 IN TXT "server=edge1"`, `txt.example. 0 IN TXT "192.0.2.2"`},
+		"whoami.example.": {`whoami.example. 0 CH TXT "2001:db8::2"`},
+		"mixed.example.":  {`mixed.example. 0 IN TXT "192.0.2.3"`, `mixed.example. 0 IN TXT "2001:db8::3"`},
+		"empty.example.":  {},
+	})
+
+	tests := []struct {
+		name    string
+		source  string
+		config  map[string]any
+		want    string
+		wantErr bool
+	}{
+		{name: "A record", source: "myip.example", want: "192.0.2.1"},
+		{name: "AAAA record", source: "myip6.example", config: map[string]any{"query_type": "AAAA"}, want: "2001:db8::1"},
+		{name: "TXT skips non IP", source: "txt.example", config: map[string]any{"query_type": "TXT"}, want: "192.0.2.2"},
+		{name: "chaos class", source: "whoami.example", config: map[string]any{"query_type": "TXT", "class": "CH"}, want: "2001:db8::2"},
+		{name: "first IP of TXT", source: "mixed.example", config: map[string]any{"query_type": "TXT"}, want: "192.0.2.3"},
+		{name: "no answer", source: "empty.example", wantErr: true},
+		{name: "name error", source: "missing.example", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := map[string]any{"server": "127.0.0.1", "port": port}
+			for k, v := range tt.config {
+				c[k] = v
+			}
+
+			s, err := newDNS(context.Background(), config.IPSource{Type: "dns", Source: tt.source, Config: c})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ip, err := s.Lookup(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+
+			if err == nil && !ip.Equal(net.ParseIP(tt.want)) {
+				t.Errorf("ip = %s, want %s", ip, tt.want)
+			}
+		})
+	}
+}
+
+func TestDNSConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		config map[string]any
+	}{
+		{name: "no server for custom name", source: "myip.example"},
+		{name: "bad network", source: "myip.opendns.com", config: map[string]any{"network": "sctp"}},
+		{name: "unsupported query type", source: "myip.opendns.com", config: map[string]any{"query_type": "MX"}},
+		{name: "family mismatch", source: "myip.opendns.com", config: map[string]any{"query_type": "A", "type": "ipv6"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newDNS(context.Background(), config.IPSource{Type: "dns", Source: tt.source, Config: tt.config}); err == nil {
+				t.Error("bad config accepted")
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package sources
+
+import (
+	"bytes"
+	"cfddns/common"
+	"cfddns/config"
+	"cfddns/log"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const defaultExecTimeout = 10 * time.Second
+
+type execCommand struct {
+	config.IPSourceExecConfig `mapstructure:",squash"`
+
+	path  string
+	args  []string
+	env   []string
+	regex *regexp.Regexp
+}
+
+func (s *execCommand) Typename() string {
+	return "exec"
+}
+
+func (s *execCommand) Family() (common.Family, bool) {
+	return s.Type, true
+}
+
+// parse finds IP in output, according to line and regex config.
+func (s *execCommand) parse(output []byte) (net.IP, error) {
+	if s.Line > 0 {
+		var err error
+		if output, err = lineOf(output, s.Line); err != nil {
+			return nil, err
+		}
+	}
+
+	return extractIP(output, s.regex, s.Type)
+}
+
+func (s *execCommand) Lookup(ctx context.Context) (result net.IP, err error) {
+	timeout := time.Duration(s.Timeout)
+	ctx = log.SWith(ctx, "command", s.path, "args", s.args, "family", s.Type, "timeout", timeout)
+
+	defer func() {
+		if err == nil {
+			log.S(ctx).Debugw("got ip", log.IP(result))
+		}
+	}()
+
+	tCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(tCtx, s.path, s.args...)
+	cmd.Env = s.env
+	cmd.Dir = s.Dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	// Don't wait forever for children holding output pipes after the command is killed.
+	cmd.WaitDelay = time.Second
+
+	err = cmd.Run()
+
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr):
+		log.S(ctx).Warnw("command failed", "exit_code", exitErr.ExitCode(), log.ByteField("stderr", stderr.Bytes()))
+		return nil, fmt.Errorf("command failed: %w", err)
+	case err != nil:
+		log.S(ctx).Warnw("cannot run command", zap.Error(err))
+		return nil, fmt.Errorf("cannot run command: %w", err)
+	case stderr.Len() != 0:
+		log.S(ctx).Debugw("command wrote to stderr", log.ByteField("stderr", stderr.Bytes()))
+	}
+
+	result, err = s.parse(stdout.Bytes())
+	if err != nil {
+		log.S(ctx).Warnw("cannot parse output", log.ByteField("stdout", stdout.Bytes()), zap.Error(err))
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func newExec(ctx context.Context, config config.IPSource) (Interface, error) {
+	ctx = log.SWith(ctx, "type", "exec")
+
+	s := &execCommand{}
+	if err := common.WeakDecodeMap(config.Config, s); err != nil {
+		log.S(ctx).Errorw("bad config", zap.Error(err), "config", config.Config)
+		return nil, fmt.Errorf(`bad config: %w`, err)
+	}
+
+	// Quoting is not supported, use args for arguments containing spaces.
+	command := strings.Fields(config.Source)
+	if len(command) == 0 {
+		log.S(ctx).Errorw("command not set")
+		return nil, fmt.Errorf("command not set")
+	}
+
+	s.path = command[0]
+	s.args = append(command[1:], s.Args...)
+
+	if len(s.Env) != 0 {
+		s.env = os.Environ()
+		for k, v := range s.Env {
+			s.env = append(s.env, k+"="+v)
+		}
+	}
+
+	if s.Regex != "" {
+		regex, err := regexp.Compile(s.Regex)
+		if err != nil {
+			log.S(ctx).Errorw("bad regex", "regex", s.Regex, zap.Error(err))
+			return nil, fmt.Errorf("bad regex: %w", err)
+		}
+
+		s.regex = regex
+	}
+
+	if s.Line < 0 {
+		log.S(ctx).Errorw("bad line number", "line", s.Line)
+		return nil, fmt.Errorf("bad line number %d", s.Line)
+	}
+
+	if s.Timeout <= 0 {
+		s.Timeout = common.Duration(defaultExecTimeout)
+	}
+
+	return s, nil
+}
@@ -0,0 +1,85 @@
+package sources
+
+import (
+	"cfddns/config"
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// writeScript writes a shell script of body into a temporary directory, and returns its path.
+func writeScript(t *testing.T, body string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "script.sh")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body+"\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestExec(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell scripts are not supported")
+	}
+
+	tests := []struct {
+		name    string
+		script  string
+		args    string
+		config  map[string]any
+		want    string
+		wantErr bool
+	}{
+		{name: "first ip", script: `echo "lan 192.0.2.1"; echo "wan 192.0.2.2"`, want: "192.0.2.1"},
+		{name: "line", script: `echo "lan 192.0.2.1"; echo "wan 192.0.2.2"`, config: map[string]any{"line": 2}, want: "192.0.2.2"},
+		{name: "regex", script: `echo "lan=192.0.2.1 wan=192.0.2.2"`, config: map[string]any{"regex": `wan=([0-9.]+)`}, want: "192.0.2.2"},
+		{name: "args", script: `echo "$1"`, args: " 192.0.2.3", config: map[string]any{"args": []any{"ignored"}}, want: "192.0.2.3"},
+		{name: "env", script: `echo "$WAN_IP"`, config: map[string]any{"env": map[string]any{"WAN_IP": "192.0.2.4"}}, want: "192.0.2.4"},
+		{name: "stderr ignored", script: `echo "192.0.2.9" >&2; echo "192.0.2.5"`, want: "192.0.2.5"},
+		{name: "non-zero exit", script: `echo "192.0.2.1"; exit 3`, wantErr: true},
+		{name: "no ip", script: `echo "no address"`, wantErr: true},
+		{name: "line out of range", script: `echo "192.0.2.1"`, config: map[string]any{"line": 2}, wantErr: true},
+		{name: "timeout", script: `exec sleep 10`, config: map[string]any{"timeout": "100ms"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := map[string]any{"type": "ipv4"}
+			for k, v := range tt.config {
+				c[k] = v
+			}
+
+			s, err := newExec(context.Background(), config.IPSource{Type: "exec", Source: writeScript(t, tt.script) + tt.args, Config: c})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			start := time.Now()
+			ip, err := s.Lookup(context.Background())
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("lookup took %s", elapsed)
+			}
+
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ip = %s, want error", ip)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !ip.Equal(net.ParseIP(tt.want)) {
+				t.Errorf("ip = %s, want %s", ip, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package sources
+
+import (
+	"bytes"
+	"cfddns/common"
+	"cfddns/config"
+	"cfddns/log"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"go.uber.org/zap"
+)
+
+const defaultMaxReadFile = 64 * 1024
+
+type file struct {
+	config.IPSourceFileConfig `mapstructure:",squash"`
+
+	path     string
+	jsonPath jsonPath
+	regex    *regexp.Regexp
+}
+
+func (s *file) Typename() string {
+	return "file"
+}
+
+func (s *file) Family() (common.Family, bool) {
+	return s.Type, true
+}
+
+// valueOf returns value of the first "key=value" line having key in text.
+func valueOf(text []byte, key string) ([]byte, error) {
+	for _, line := range bytes.Split(text, []byte("\n")) {
+		k, v, ok := bytes.Cut(line, []byte("="))
+		if ok && string(bytes.TrimSpace(k)) == key {
+			return v, nil
+		}
+	}
+
+	return nil, fmt.Errorf("key %q not found", key)
+}
+
+// parse returns the part of content to search IP in, according to line, key and json_path config.
+func (s *file) parse(content []byte) (text []byte, err error) {
+	switch {
+	case s.Line > 0:
+		return lineOf(content, s.Line)
+	case s.Key != "":
+		return valueOf(content, s.Key)
+	case s.JSONPath != "":
+		return s.jsonPath.extract(content)
+	default:
+		return content, nil
+	}
+}
+
+func (s *file) Lookup(ctx context.Context) (result net.IP, err error) {
+	ctx = log.SWith(ctx, "path", s.path, "family", s.Type)
+
+	defer func() {
+		if err == nil {
+			log.S(ctx).Debugw("got ip", log.IP(result))
+		}
+	}()
+
+	f, err := os.Open(s.path)
+	if err != nil {
+		log.S(ctx).Warnw("cannot open file", zap.Error(err))
+		return nil, fmt.Errorf("cannot open file: %w", err)
+	}
+
+	defer f.Close()
+
+	content, err := io.ReadAll(io.LimitReader(f, defaultMaxReadFile))
+	if err != nil {
+		log.S(ctx).Warnw("cannot read file", zap.Error(err))
+		return nil, fmt.Errorf("cannot read file: %w", err)
+	}
+
+	text, err := s.parse(content)
+	if err != nil {
+		log.S(ctx).Warnw("cannot parse file", log.ByteField("content", content), zap.Error(err))
+		return nil, fmt.Errorf("cannot parse file: %w", err)
+	}
+
+	result, err = extractIP(text, s.regex, s.Type)
+	if err != nil {
+		log.S(ctx).Warnw("no IP found in file", log.ByteField("content", content), zap.Error(err))
+		return nil, fmt.Errorf("no IP found in file: %w", err)
+	}
+
+	return result, nil
+}
+
+func (s *file) Watch(ctx context.Context, trigger func()) error {
+	if !s.IPSourceFileConfig.Watch {
+		return nil
+	}
+
+	ctx = log.SWith(ctx, "path", s.path)
+	log.S(ctx).Infow("watching file changes")
+
+	// Watch the directory instead of the file, so replacing the file by renaming is noticed.
+	name := filepath.Base(s.path)
+	return watchDir(ctx, filepath.Dir(s.path), func(changed string) {
+		if changed == "" {
+			log.S(ctx).Warnw("file change events lost")
+			trigger()
+			return
+		}
+
+		if changed != name {
+			return
+		}
+
+		log.S(ctx).Infow("file changed")
+		trigger()
+	})
+}
+
+func newFile(ctx context.Context, config config.IPSource) (Interface, error) {
+	ctx = log.SWith(ctx, "type", "file")
+
+	s := &file{path: config.Source}
+	if err := common.WeakDecodeMap(config.Config, s); err != nil {
+		log.S(ctx).Errorw("bad config", zap.Error(err), "config", config.Config)
+		return nil, fmt.Errorf(`bad config: %w`, err)
+	}
+
+	if s.path == "" {
+		log.S(ctx).Errorw("path not set")
+		return nil, fmt.Errorf("path not set")
+	}
+
+	selectors := 0
+	for _, set := range []bool{s.Line != 0, s.Key != "", s.JSONPath != ""} {
+		if set {
+			selectors++
+		}
+	}
+
+	if selectors > 1 {
+		log.S(ctx).Errorw("only one of line, key and json_path can be set", "line", s.Line, "key", s.Key, "json_path", s.JSONPath)
+		return nil, fmt.Errorf("only one of line, key and json_path can be set")
+	}
+
+	if s.Line < 0 {
+		log.S(ctx).Errorw("bad line number", "line", s.Line)
+		return nil, fmt.Errorf("bad line number %d", s.Line)
+	}
+
+	if s.JSONPath != "" {
+		path, err := parseJSONPath(s.JSONPath)
+		if err != nil {
+			log.S(ctx).Errorw("bad json path", "json_path", s.JSONPath, zap.Error(err))
+			return nil, fmt.Errorf("bad json path: %w", err)
+		}
+
+		s.jsonPath = path
+	}
+
+	if s.Regex != "" {
+		regex, err := regexp.Compile(s.Regex)
+		if err != nil {
+			log.S(ctx).Errorw("bad regex", "regex", s.Regex, zap.Error(err))
+			return nil, fmt.Errorf("bad regex: %w", err)
+		}
+
+		s.regex = regex
+	}
+
+	return s, nil
+}
@@ -0,0 +1,61 @@
+package sources
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// watchDir calls fn with name of the entry in dir whenever it's written, replaced or removed,
+// until ctx is done or an error occurs. If some events are lost, fn is called with empty name.
+func watchDir(ctx context.Context, dir string, fn func(name string)) error {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return fmt.Errorf("inotify init: %w", err)
+	}
+
+	// Non-blocking fd is handled by the runtime poller, so Close interrupts pending Read.
+	f := os.NewFile(uintptr(fd), "inotify")
+	defer f.Close()
+
+	mask := uint32(unix.IN_CLOSE_WRITE | unix.IN_MOVED_TO | unix.IN_MOVED_FROM | unix.IN_DELETE)
+	if _, err := unix.InotifyAddWatch(fd, dir, mask); err != nil {
+		return fmt.Errorf("inotify watch %s: %w", dir, err)
+	}
+
+	go func() {
+		<-ctx.Done()
+		_ = f.Close()
+	}()
+
+	buf := make([]byte, 4096)
+	for {
+		n, err := f.Read(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return fmt.Errorf("inotify read: %w", err)
+		}
+
+		for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+			event := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + unix.SizeofInotifyEvent
+			offset = nameStart + int(event.Len)
+
+			if event.Mask&unix.IN_Q_OVERFLOW != 0 {
+				fn("")
+				continue
+			}
+
+			if event.Len != 0 {
+				fn(string(bytes.TrimRight(buf[nameStart:offset], "\x00")))
+			}
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package sources
+
+import (
+	"cfddns/config"
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Replacing the file by renaming triggers refresh, and the new content is read.
+func TestFileWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wan")
+	writeFile(t, path, "192.0.2.1\n")
+
+	s, err := newFile(context.Background(), config.IPSource{Type: "file", Source: path, Config: map[string]any{"type": "ipv4", "watch": true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	triggered := make(chan struct{}, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- s.(Watcher).Watch(ctx, func() {
+			select {
+			case triggered <- struct{}{}:
+			default:
+			}
+		})
+	}()
+
+	// Watch starts in background, keep replacing the file until it's noticed.
+	timeout := time.After(5 * time.Second)
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
+Wait:
+	for {
+		select {
+		case <-triggered:
+			break Wait
+		case <-ticker.C:
+			writeFile(t, path, "192.0.2.2\n")
+		case <-timeout:
+			t.Fatal("change not noticed")
+		}
+	}
+
+	ip, err := s.Lookup(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !ip.Equal(net.ParseIP("192.0.2.2")) {
+		t.Errorf("ip = %s, want 192.0.2.2", ip)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("watch failed: %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+package sources
+
+import (
+	"cfddns/config"
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeFile atomically replaces path with content, by writing a temporary file and renaming it.
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFile(t *testing.T) {
+	const env = "# wan status\nLAN_IP=192.0.2.1\nWAN_IP = 192.0.2.2\n"
+
+	tests := []struct {
+		name    string
+		content string
+		config  map[string]any
+		want    string
+		wantErr bool
+	}{
+		{name: "first ip", content: env, want: "192.0.2.1"},
+		{name: "line", content: env, config: map[string]any{"line": 3}, want: "192.0.2.2"},
+		{name: "key", content: env, config: map[string]any{"key": "WAN_IP"}, want: "192.0.2.2"},
+		{name: "json path", content: `{"wan": {"ipv4": "192.0.2.3"}, "lan": "192.0.2.1"}`, config: map[string]any{"json_path": "$.wan.ipv4"}, want: "192.0.2.3"},
+		{name: "regex", content: "lan=192.0.2.1 wan=192.0.2.4", config: map[string]any{"regex": `wan=([0-9.]+)`}, want: "192.0.2.4"},
+		{name: "ipv6", content: "addr 192.0.2.1\naddr 2001:db8::1/64\n", config: map[string]any{"type": "ipv6"}, want: "2001:db8::1"},
+		{name: "missing key", content: env, config: map[string]any{"key": "PPP_IP"}, wantErr: true},
+		{name: "line out of range", content: env, config: map[string]any{"line": 9}, wantErr: true},
+		{name: "no ip", content: "# wan down\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "wan")
+			writeFile(t, path, tt.content)
+
+			c := map[string]any{"type": "ipv4"}
+			for k, v := range tt.config {
+				c[k] = v
+			}
+
+			s, err := newFile(context.Background(), config.IPSource{Type: "file", Source: path, Config: c})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ip, err := s.Lookup(context.Background())
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ip = %s, want error", ip)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !ip.Equal(net.ParseIP(tt.want)) {
+				t.Errorf("ip = %s, want %s", ip, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileMissing(t *testing.T) {
+	s, err := newFile(context.Background(), config.IPSource{Type: "file", Source: filepath.Join(t.TempDir(), "missing")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ip, err := s.Lookup(context.Background()); err == nil {
+		t.Errorf("ip = %s, want error", ip)
+	}
+}
+
+func TestFileBadConfig(t *testing.T) {
+	for _, c := range []map[string]any{
+		{"line": 1, "key": "WAN_IP"},
+		{"line": -1},
+		{"json_path": "wan"},
+		{"regex": "("},
+	} {
+		if _, err := newFile(context.Background(), config.IPSource{Type: "file", Source: "/tmp/wan", Config: c}); err == nil {
+			t.Errorf("config %v accepted", c)
+		}
+	}
+}
@@ -0,0 +1,10 @@
+package sources
+
+import (
+	"context"
+	"fmt"
+)
+
+func watchDir(ctx context.Context, dir string, fn func(name string)) error {
+	return fmt.Errorf("watching file changes is not supported")
+}
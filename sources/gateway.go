@@ -0,0 +1,251 @@
+package sources
+
+import (
+	"cfddns/common"
+	"cfddns/config"
+	"cfddns/log"
+	"cfddns/sources/netif"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"slices"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultGatewayTimeout = 5 * time.Second
+
+	// NAT-PMP and PCP share the same port.
+	natPMPPort = "5351"
+	ssdpPort   = "1900"
+	// Initial retransmission timeout of NAT-PMP and PCP. See RFC 6886 Section 3.1.
+	natPMPRTO = 250 * time.Millisecond
+
+	pcpVersion = 2
+	pcpOpMap   = 1
+	// Lifetime of the temporary mapping made to learn external address. It's deleted right after.
+	pcpLifetime = 60
+)
+
+var defaultGatewayProtocols = []string{"nat-pmp", "pcp", "upnp"}
+
+var gatewayProtocols = map[string]func(ctx context.Context, addr string) (net.IP, error){
+	"nat-pmp": queryNATPMP,
+	"pcp":     queryPCP,
+	"upnp":    queryUPnP,
+}
+
+// Port of gateway each protocol is sent to.
+var gatewayPorts = map[string]string{
+	"nat-pmp": natPMPPort,
+	"pcp":     natPMPPort,
+	"upnp":    ssdpPort,
+}
+
+// Shared address space used by carrier-grade NAT, see RFC 6598.
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0).To4(), Mask: net.CIDRMask(10, 32)}
+
+type gateway struct {
+	config.IPSourceGatewayConfig `mapstructure:",squash"`
+
+	gateway string
+	// ports overrides gatewayPorts, used by tests.
+	ports map[string]string
+}
+
+func (s *gateway) Typename() string {
+	return "gateway"
+}
+
+func (s *gateway) Family() (common.Family, bool) {
+	return common.IPv4, true
+}
+
+func (s *gateway) Lookup(ctx context.Context) (result net.IP, err error) {
+	gw := s.gateway
+	if gw == "" {
+		route, err := netif.DefaultGateway(false)
+		if err != nil {
+			log.S(ctx).Warnw("cannot find default gateway", zap.Error(err))
+			return nil, fmt.Errorf("cannot find default gateway: %w", err)
+		}
+
+		gw = route.Gateway.String()
+	}
+
+	ctx = log.SWith(ctx, "gateway", gw)
+
+	for _, protocol := range s.Protocols {
+		ctx := log.SWith(ctx, "protocol", protocol)
+
+		port, ok := s.ports[protocol]
+		if !ok {
+			port = gatewayPorts[protocol]
+		}
+
+		qCtx, cancel := context.WithTimeout(ctx, time.Duration(s.Timeout))
+		result, err = gatewayProtocols[protocol](qCtx, net.JoinHostPort(gw, port))
+		cancel()
+
+		if err != nil {
+			log.S(ctx).Warnw("query failed", zap.Error(err))
+			continue
+		}
+
+		// Gateway behind another NAT knows only its private address.
+		if result = result.To4(); result == nil || result.IsUnspecified() || result.IsPrivate() || sharedAddressSpace.Contains(result) {
+			log.S(ctx).Warnw("gateway has no public address", log.IP(result))
+			err = fmt.Errorf("gateway has no public address")
+			continue
+		}
+
+		log.S(ctx).Debugw("got ip", log.IP(result))
+		return result, nil
+	}
+
+	return nil, fmt.Errorf("all protocol failed, last error: %w", err)
+}
+
+func dialGateway(ctx context.Context, addr string) (net.Conn, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp4", addr)
+	if err != nil {
+		return nil, fmt.Errorf("dial failed: %w", err)
+	}
+
+	return conn, nil
+}
+
+// queryNATPMP asks for external address with NAT-PMP, see RFC 6886 Section 3.2.
+func queryNATPMP(ctx context.Context, addr string) (ip net.IP, err error) {
+	conn, err := dialGateway(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Close()
+
+	err = exchangeUDP(ctx, conn, []byte{0, 0}, natPMPRTO, func(response []byte) (err error) {
+		ip, err = parseNATPMPResponse(response)
+		return err
+	})
+
+	return
+}
+
+// parseNATPMPResponse extracts external address from response to NAT-PMP external address
+// request. Responses of other requests return errSkipResponse.
+func parseNATPMPResponse(response []byte) (net.IP, error) {
+	if len(response) < 12 || response[0] != 0 || response[1] != 128 {
+		return nil, errSkipResponse
+	}
+
+	if code := binary.BigEndian.Uint16(response[2:4]); code != 0 {
+		return nil, fmt.Errorf("gateway replied error %d", code)
+	}
+
+	return slices.Clone(response[8:12]), nil
+}
+
+// queryPCP learns external address by creating a short-lived MAP mapping with PCP, see RFC 6887 Section 11.
+func queryPCP(ctx context.Context, addr string) (ip net.IP, err error) {
+	conn, err := dialGateway(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Close()
+
+	local := conn.LocalAddr().(*net.UDPAddr)
+
+	request := make([]byte, 60)
+	request[0] = pcpVersion
+	request[1] = pcpOpMap
+	binary.BigEndian.PutUint32(request[4:8], pcpLifetime)
+	copy(request[8:24], local.IP.To16())
+	nonce := request[24:36]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	request[36] = 17 // UDP
+	binary.BigEndian.PutUint16(request[40:42], uint16(local.Port))
+	// No preference on external address, written as IPv4-mapped 0.0.0.0.
+	copy(request[44:60], net.IPv4zero.To16())
+
+	err = exchangeUDP(ctx, conn, request, natPMPRTO, func(response []byte) (err error) {
+		ip, err = parsePCPResponse(response, nonce)
+		return err
+	})
+
+	if err == nil {
+		// Delete the mapping. It expires soon anyway, so failure is ignored.
+		binary.BigEndian.PutUint32(request[4:8], 0)
+		_, _ = conn.Write(request)
+	}
+
+	return
+}
+
+// parsePCPResponse extracts assigned external address from response to PCP MAP request with
+// nonce. Responses of other requests return errSkipResponse.
+func parsePCPResponse(response, nonce []byte) (net.IP, error) {
+	if len(response) >= 2 && response[0] == 0 {
+		return nil, fmt.Errorf("gateway only supports NAT-PMP")
+	}
+
+	if len(response) < 60 || response[0] != pcpVersion || response[1] != 0x80|pcpOpMap {
+		return nil, errSkipResponse
+	}
+
+	if !slices.Equal(response[24:36], nonce) {
+		return nil, errSkipResponse
+	}
+
+	if code := response[3]; code != 0 {
+		return nil, fmt.Errorf("gateway replied error %d", code)
+	}
+
+	return slices.Clone(response[44:60]), nil
+}
+
+func newGateway(ctx context.Context, config config.IPSource) (Interface, error) {
+	ctx = log.SWith(ctx, "type", "gateway")
+
+	s := &gateway{}
+	if err := common.WeakDecodeMap(config.Config, s); err != nil {
+		log.S(ctx).Errorw("bad config", zap.Error(err), "config", config.Config)
+		return nil, fmt.Errorf(`bad config: %w`, err)
+	}
+
+	if config.Source != "" {
+		ip := net.ParseIP(config.Source)
+		if ip == nil || ip.To4() == nil {
+			log.S(ctx).Errorw("gateway must be an IPv4 address", "gateway", config.Source)
+			return nil, fmt.Errorf("bad gateway address %q", config.Source)
+		}
+
+		s.gateway = ip.String()
+	}
+
+	if len(s.Protocols) == 0 {
+		s.Protocols = defaultGatewayProtocols
+	}
+
+	for _, protocol := range s.Protocols {
+		if _, ok := gatewayProtocols[protocol]; !ok {
+			log.S(ctx).Errorw("unknown protocol", "protocol", protocol)
+			return nil, fmt.Errorf("unknown protocol %q", protocol)
+		}
+	}
+
+	if s.Timeout <= 0 {
+		s.Timeout = common.Duration(defaultGatewayTimeout)
+	}
+
+	return s, nil
+}
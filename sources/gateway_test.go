@@ -0,0 +1,281 @@
+package sources
+
+import (
+	"cfddns/config"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// natPMPResponse encodes NAT-PMP external address response with result code and ip.
+func natPMPResponse(code uint16, ip net.IP) []byte {
+	response := []byte{0, 128}
+	response = binary.BigEndian.AppendUint16(response, code)
+	response = binary.BigEndian.AppendUint32(response, 3600)
+	return append(response, ip.To4()...)
+}
+
+// pcpResponse encodes PCP MAP response with result code, nonce and ip.
+func pcpResponse(code byte, nonce []byte, ip net.IP) []byte {
+	response := make([]byte, 60)
+	response[0] = pcpVersion
+	response[1] = 0x80 | pcpOpMap
+	response[3] = code
+	binary.BigEndian.PutUint32(response[4:8], pcpLifetime)
+	copy(response[24:36], nonce)
+	response[36] = 17
+	copy(response[44:60], ip.To16())
+	return response
+}
+
+type gatewayParseTest struct {
+	name     string
+	response []byte
+	want     net.IP
+	wantSkip bool
+	wantErr  bool
+}
+
+func checkGatewayParse(t *testing.T, tt gatewayParseTest, ip net.IP, err error) {
+	t.Helper()
+
+	switch {
+	case tt.wantSkip:
+		if !errors.Is(err, errSkipResponse) {
+			t.Errorf("err = %v, want skipped", err)
+		}
+	case tt.wantErr:
+		if err == nil || errors.Is(err, errSkipResponse) {
+			t.Errorf("err = %v, want error", err)
+		}
+	case err != nil:
+		t.Errorf("err = %v", err)
+	case !ip.Equal(tt.want):
+		t.Errorf("ip = %s, want %s", ip, tt.want)
+	}
+}
+
+func TestParseNATPMPResponse(t *testing.T) {
+	ip := net.ParseIP("192.0.2.1")
+
+	tests := []gatewayParseTest{
+		{name: "success", response: natPMPResponse(0, ip), want: ip},
+		{name: "error code", response: natPMPResponse(3, ip), wantErr: true},
+		{name: "too short", response: natPMPResponse(0, ip)[:8], wantSkip: true},
+		{name: "other opcode", response: append([]byte{0, 129}, natPMPResponse(0, ip)[2:]...), wantSkip: true},
+		{name: "other version", response: append([]byte{2, 128}, natPMPResponse(0, ip)[2:]...), wantSkip: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ip, err := parseNATPMPResponse(tt.response)
+			checkGatewayParse(t, tt, ip, err)
+		})
+	}
+}
+
+func TestParsePCPResponse(t *testing.T) {
+	ip := net.ParseIP("192.0.2.1")
+	nonce := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}
+	request := pcpResponse(0, nonce, ip)
+	request[1] = pcpOpMap
+
+	tests := []gatewayParseTest{
+		{name: "success", response: pcpResponse(0, nonce, ip), want: ip},
+		{name: "error code", response: pcpResponse(2, nonce, ip), wantErr: true},
+		{name: "nat-pmp only", response: []byte{0, 128 + pcpOpMap, 0, 1}, wantErr: true},
+		{name: "other nonce", response: pcpResponse(0, make([]byte, 12), ip), wantSkip: true},
+		{name: "request echoed", response: request, wantSkip: true},
+		{name: "too short", response: pcpResponse(0, nonce, ip)[:40], wantSkip: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ip, err := parsePCPResponse(tt.response, nonce)
+			checkGatewayParse(t, tt, ip, err)
+		})
+	}
+}
+
+// newGatewayResponder starts a UDP responder on loopback, and returns its port. Requests are
+// answered with what reply returns, or ignored if it's nil. If otherPort is set, replies are
+// sent from another port, like many gateways reply SSDP.
+func newGatewayResponder(t *testing.T, otherPort bool, reply func(request []byte) []byte) string {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { _ = conn.Close() })
+
+	sender := conn
+	if otherPort {
+		if sender, err = net.ListenPacket("udp4", "127.0.0.1:0"); err != nil {
+			t.Fatal(err)
+		}
+
+		t.Cleanup(func() { _ = sender.Close() })
+	}
+
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+
+			if response := reply(buf[:n]); response != nil {
+				_, _ = sender.WriteTo(response, addr)
+			}
+		}
+	}()
+
+	return fmt.Sprint(conn.LocalAddr().(*net.UDPAddr).Port)
+}
+
+// newFakeIGD starts an IGD serving description and GetExternalIPAddress action of ip, and an SSDP
+// responder pointing to it. It returns port of SSDP responder.
+func newFakeIGD(t *testing.T, ip string) string {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /desc.xml", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`<?xml version="1.0"?>
+<root xmlns="urn:schemas-upnp-org:device-1-0">
+<device>
+	<deviceType>urn:schemas-upnp-org:device:InternetGatewayDevice:1</deviceType>
+	<deviceList><device>
+		<deviceType>urn:schemas-upnp-org:device:WANDevice:1</deviceType>
+		<deviceList><device>
+			<deviceType>urn:schemas-upnp-org:device:WANConnectionDevice:1</deviceType>
+			<serviceList><service>
+				<serviceType>urn:schemas-upnp-org:service:WANIPConnection:1</serviceType>
+				<controlURL>/ctl/IPConn</controlURL>
+			</service></serviceList>
+		</device></deviceList>
+	</device></deviceList>
+</device>
+</root>`))
+	})
+	mux.HandleFunc("POST /ctl/IPConn", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("SOAPAction") != `"urn:schemas-upnp-org:service:WANIPConnection:1#GetExternalIPAddress"` {
+			http.Error(w, "unknown action", http.StatusInternalServerError)
+			return
+		}
+
+		_, _ = w.Write([]byte(`<?xml version="1.0"?>
+<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body>
+<u:GetExternalIPAddressResponse xmlns:u="urn:schemas-upnp-org:service:WANIPConnection:1">
+<NewExternalIPAddress>` + ip + `</NewExternalIPAddress>
+</u:GetExternalIPAddressResponse>
+</s:Body></s:Envelope>`))
+	})
+
+	s := httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+
+	return newGatewayResponder(t, true, func(request []byte) []byte {
+		if !strings.HasPrefix(string(request), "M-SEARCH * HTTP/1.1\r\n") {
+			return nil
+		}
+
+		return []byte("HTTP/1.1 200 OK\r\n" +
+			"CACHE-CONTROL: max-age=120\r\n" +
+			"ST: " + upnpSearchTarget + "\r\n" +
+			"LOCATION: " + s.URL + "/desc.xml\r\n\r\n")
+	})
+}
+
+func TestGatewayLookup(t *testing.T) {
+	natPMP := func(ip string) func([]byte) []byte {
+		return func(request []byte) []byte {
+			if len(request) != 2 || request[0] != 0 || request[1] != 0 {
+				return nil
+			}
+
+			return natPMPResponse(0, net.ParseIP(ip))
+		}
+	}
+
+	pcp := func(ip string) func([]byte) []byte {
+		return func(request []byte) []byte {
+			if len(request) < 60 || request[0] == 0 {
+				return natPMPResponse(0, net.ParseIP(ip))[:4]
+			}
+
+			// Deleting the mapping.
+			if binary.BigEndian.Uint32(request[4:8]) == 0 {
+				return nil
+			}
+
+			return pcpResponse(0, request[24:36], net.ParseIP(ip))
+		}
+	}
+
+	silent := func([]byte) []byte { return nil }
+
+	tests := []struct {
+		name      string
+		protocols []string
+		natPMP    func([]byte) []byte
+		upnp      string
+		want      string
+		wantErr   bool
+	}{
+		{name: "nat-pmp", protocols: []string{"nat-pmp"}, natPMP: natPMP("192.0.2.1"), want: "192.0.2.1"},
+		{name: "pcp", protocols: []string{"pcp"}, natPMP: pcp("192.0.2.2"), want: "192.0.2.2"},
+		{name: "upnp", protocols: []string{"upnp"}, upnp: "192.0.2.3", want: "192.0.2.3"},
+		{name: "fallback to upnp", protocols: []string{"nat-pmp", "upnp"}, natPMP: silent, upnp: "192.0.2.3", want: "192.0.2.3"},
+		{name: "private address", protocols: []string{"nat-pmp"}, natPMP: natPMP("192.168.1.2"), wantErr: true},
+		{name: "shared address", protocols: []string{"upnp"}, upnp: "100.64.0.1", wantErr: true},
+		{name: "no reply", protocols: []string{"pcp"}, natPMP: silent, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ports := map[string]string{}
+			if tt.natPMP != nil {
+				port := newGatewayResponder(t, false, tt.natPMP)
+				ports["nat-pmp"], ports["pcp"] = port, port
+			}
+
+			if tt.upnp != "" {
+				ports["upnp"] = newFakeIGD(t, tt.upnp)
+			}
+
+			source, err := newGateway(context.Background(), config.IPSource{Type: "gateway", Source: "127.0.0.1", Config: map[string]any{
+				"protocols": tt.protocols,
+				"timeout":   "1s",
+			}})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			source.(*gateway).ports = ports
+			ip, err := source.Lookup(context.Background())
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ip = %s, want error", ip)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !ip.Equal(net.ParseIP(tt.want)) {
+				t.Errorf("ip = %s, want %s", ip, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,242 @@
+package sources
+
+import (
+	"bufio"
+	"bytes"
+	"cfddns/log"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	ssdpRTO = time.Second
+
+	maxReadUPnP = 64 * 1024
+
+	upnpSearchTarget = "urn:schemas-upnp-org:device:InternetGatewayDevice:1"
+)
+
+// Services able to report external address, in preferred order.
+var upnpServiceTypes = []string{
+	"urn:schemas-upnp-org:service:WANIPConnection:2",
+	"urn:schemas-upnp-org:service:WANIPConnection:1",
+	"urn:schemas-upnp-org:service:WANPPPConnection:1",
+}
+
+type upnpService struct {
+	ServiceType string `xml:"serviceType"`
+	ControlURL  string `xml:"controlURL"`
+}
+
+type upnpDevice struct {
+	Services []upnpService `xml:"serviceList>service"`
+	Devices  []upnpDevice  `xml:"deviceList>device"`
+}
+
+func (d *upnpDevice) find(serviceType string) *upnpService {
+	for i := range d.Services {
+		if d.Services[i].ServiceType == serviceType {
+			return &d.Services[i]
+		}
+	}
+
+	for i := range d.Devices {
+		if service := d.Devices[i].find(serviceType); service != nil {
+			return service
+		}
+	}
+
+	return nil
+}
+
+type upnpDescription struct {
+	URLBase string     `xml:"URLBase"`
+	Device  upnpDevice `xml:"device"`
+}
+
+type upnpExternalIPResponse struct {
+	IP string `xml:"Body>GetExternalIPAddressResponse>NewExternalIPAddress"`
+}
+
+// ssdpConn sends to gateway with an unconnected socket, and receives from any port of gateway,
+// as many gateways reply M-SEARCH from another port, which connected socket drops.
+type ssdpConn struct {
+	net.PacketConn
+
+	gateway *net.UDPAddr
+}
+
+func (c *ssdpConn) RemoteAddr() net.Addr {
+	return c.gateway
+}
+
+func (c *ssdpConn) Write(b []byte) (int, error) {
+	return c.WriteTo(b, c.gateway)
+}
+
+func (c *ssdpConn) Read(b []byte) (int, error) {
+	for {
+		n, addr, err := c.ReadFrom(b)
+		if err != nil {
+			return n, err
+		}
+
+		if from, ok := addr.(*net.UDPAddr); ok && from.IP.Equal(c.gateway.IP) {
+			return n, nil
+		}
+	}
+}
+
+// discoverUPnP finds description URL of gateway with SSDP, sending M-SEARCH directly to the gateway.
+func discoverUPnP(ctx context.Context, addr string) (location string, err error) {
+	gateway, err := net.ResolveUDPAddr("udp4", addr)
+	if err != nil {
+		return "", fmt.Errorf("bad gateway address: %w", err)
+	}
+
+	var lc net.ListenConfig
+	pc, err := lc.ListenPacket(ctx, "udp4", ":0")
+	if err != nil {
+		return "", fmt.Errorf("listen failed: %w", err)
+	}
+
+	conn := &ssdpConn{PacketConn: pc, gateway: gateway}
+	defer conn.Close()
+
+	request := "M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: " + addr + "\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"MX: 1\r\n" +
+		"ST: " + upnpSearchTarget + "\r\n\r\n"
+
+	err = exchangeUDP(ctx, conn, []byte(request), ssdpRTO, func(response []byte) error {
+		resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(response)), nil)
+		if err != nil || resp.StatusCode != http.StatusOK || resp.Header.Get("Location") == "" {
+			return errSkipResponse
+		}
+
+		location = resp.Header.Get("Location")
+		return nil
+	})
+
+	return
+}
+
+func upnpRequest(ctx context.Context, req *http.Request) ([]byte, error) {
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf(`connection failed: %w`, err)
+	}
+
+	defer func(Body io.ReadCloser) {
+		if err := Body.Close(); err != nil {
+			log.S(ctx).Warnw("close body failed", zap.Error(err))
+		}
+	}(resp.Body)
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxReadUPnP))
+	if err != nil {
+		return nil, fmt.Errorf(`failed receiving response: %w`, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return data, fmt.Errorf("bad status: %s", resp.Status)
+	}
+
+	return data, nil
+}
+
+// findUPnPService finds control URL of a service reporting external address, from device description.
+func findUPnPService(ctx context.Context, location string) (controlURL, serviceType string, err error) {
+	req, err := http.NewRequest("GET", location, nil)
+	if err != nil {
+		return "", "", fmt.Errorf("bad location: %w", err)
+	}
+
+	data, err := upnpRequest(ctx, req)
+	if err != nil {
+		return "", "", fmt.Errorf("failed loading description: %w", err)
+	}
+
+	var desc upnpDescription
+	if err := xml.Unmarshal(data, &desc); err != nil {
+		return "", "", fmt.Errorf("bad description: %w", err)
+	}
+
+	base := req.URL
+	if desc.URLBase != "" {
+		if base, err = url.Parse(desc.URLBase); err != nil {
+			return "", "", fmt.Errorf("bad URLBase: %w", err)
+		}
+	}
+
+	for _, serviceType := range upnpServiceTypes {
+		service := desc.Device.find(serviceType)
+		if service == nil {
+			continue
+		}
+
+		control, err := base.Parse(service.ControlURL)
+		if err != nil {
+			return "", "", fmt.Errorf("bad controlURL: %w", err)
+		}
+
+		return control.String(), serviceType, nil
+	}
+
+	return "", "", fmt.Errorf("no WAN connection service found")
+}
+
+// queryUPnP asks for external address with UPnP IGD GetExternalIPAddress action.
+func queryUPnP(ctx context.Context, addr string) (net.IP, error) {
+	location, err := discoverUPnP(ctx, addr)
+	if err != nil {
+		return nil, fmt.Errorf("discover failed: %w", err)
+	}
+
+	controlURL, serviceType, err := findUPnPService(ctx, location)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = log.SWith(ctx, "control_url", controlURL, "service_type", serviceType)
+
+	body := `<?xml version="1.0"?>` +
+		`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">` +
+		`<s:Body><u:GetExternalIPAddress xmlns:u="` + serviceType + `"/></s:Body></s:Envelope>`
+
+	req, err := http.NewRequest("POST", controlURL, strings.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("new request failed: %w", err)
+	}
+
+	req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	req.Header.Set("SOAPAction", `"`+serviceType+`#GetExternalIPAddress"`)
+
+	data, err := upnpRequest(ctx, req)
+	if err != nil {
+		log.S(ctx).Debugw("action failed", log.ByteField("body", data))
+		return nil, fmt.Errorf("action failed: %w", err)
+	}
+
+	var resp upnpExternalIPResponse
+	if err := xml.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("bad action response: %w", err)
+	}
+
+	ip := net.ParseIP(strings.TrimSpace(resp.IP))
+	if ip == nil {
+		return nil, fmt.Errorf("bad external address %q", resp.IP)
+	}
+
+	return ip, nil
+}
@@ -1,6 +1,7 @@
 package sources
 
 import (
+	"bytes"
 	"cfddns/common"
 	"cfddns/config"
 	"cfddns/log"
@@ -8,23 +9,58 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"path"
+	"regexp"
 	"slices"
+	"strings"
 
 	"go.uber.org/zap"
 )
 
+var interfaceFlagNames = map[string]netif.InterfaceFlags{
+	"up":           netif.FlagUp,
+	"broadcast":    netif.FlagBroadcast,
+	"loopback":     netif.FlagLoopback,
+	"pointtopoint": netif.FlagPointToPoint,
+	"multicast":    netif.FlagMulticast,
+	"running":      netif.FlagRunning,
+}
+
 type networkInterface struct {
 	config.IPSourceInterfaceConfig `mapstructure:",squash"`
 
 	iface string
 	flag  common.IPFilterFlag
+
+	// Interface matching criteria parsed from iface and InterfaceFlags.
+	name         string
+	glob         string
+	regex        *regexp.Regexp
+	mac          net.HardwareAddr
+	flagsSet     netif.InterfaceFlags
+	flagsClear   netif.InterfaceFlags
+	defaultRoute bool
 }
 
 func (s *networkInterface) Typename() string {
 	return "interface"
 }
 
-func (s *networkInterface) Lookup(ctx context.Context) (result net.IP, err error) {
+func (s *networkInterface) Family() (common.Family, bool) {
+	return s.Type, true
+}
+
+func (s *networkInterface) Lookup(ctx context.Context) (net.IP, error) {
+	ips, err := s.LookupAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return ips[0], nil
+}
+
+// LookupAll returns all eligible IP of the interface if select mode is "all", or the selected one.
+func (s *networkInterface) LookupAll(ctx context.Context) (result []net.IP, err error) {
 	ctx = log.SWith(ctx,
 		"interface", s.iface,
 		"family", s.Type,
@@ -36,24 +72,158 @@ func (s *networkInterface) Lookup(ctx context.Context) (result net.IP, err error
 
 	defer func() {
 		if err == nil {
-			log.S(ctx).Debugw("got ip", log.IP(result))
+			log.S(ctx).Debugw("got ip", log.IPs(result))
 		}
 	}()
 
-	iface, err := netif.InterfaceByName(s.iface)
+	ifaces, err := s.interfaces(ctx)
 	if err != nil {
 		log.S(ctx).Warnw("find interface failed", zap.Error(err))
 		return nil, fmt.Errorf(`find interface failed: %w`, err)
 	}
 
+	// Interfaces are sorted by preference, use the first one having eligible IP. Interface failed
+	// reading addresses, like one removed meanwhile, is skipped.
+	var addrErr error
+	for _, iface := range ifaces {
+		ctx := log.SWith(ctx, "interface_name", iface.Name)
+
+		candidate, err := s.candidates(ctx, &iface)
+		if err != nil {
+			addrErr = err
+			continue
+		}
+
+		if len(candidate) == 0 {
+			log.S(ctx).Debugw("no eligible IP found on interface")
+			continue
+		}
+
+		switch s.Select {
+		case common.SelectShortest:
+			slices.SortStableFunc(candidate, func(i, j net.IP) int {
+				return len(i.String()) - len(j.String())
+			})
+			fallthrough
+		case common.SelectFirst:
+			return candidate[:1], nil
+		case common.SelectLast:
+			return candidate[len(candidate)-1:], nil
+		case common.SelectAll:
+			return candidate, nil
+		default:
+			log.S(ctx).Errorw("unexpected select mode")
+			return nil, fmt.Errorf(`internal error: unexpected select mode`)
+		}
+	}
+
+	log.S(ctx).Warnw("no eligible IP found", "interfaces", len(ifaces), zap.Error(addrErr))
+	if addrErr != nil {
+		return nil, fmt.Errorf(`no eligible IP found, last error: %w`, addrErr)
+	}
+
+	return nil, fmt.Errorf(`no eligible IP found`)
+}
+
+// match reports whether iface matches configured name pattern, MAC address and flags.
+func (s *networkInterface) match(iface *netif.Interface) bool {
+	switch {
+	case s.name != "" && iface.Name != s.name:
+		return false
+	case s.glob != "":
+		if ok, _ := path.Match(s.glob, iface.Name); !ok {
+			return false
+		}
+	case s.regex != nil && !s.regex.MatchString(iface.Name):
+		return false
+	case s.mac != nil && !bytes.Equal(iface.HardwareAddr, s.mac):
+		return false
+	}
+
+	return iface.Flags&s.flagsSet == s.flagsSet && iface.Flags&s.flagsClear == 0
+}
+
+// interfaces returns matched interfaces. If more than one matched, interfaces with default
+// route of the family come first, ordered by route metric, and then the others by index.
+func (s *networkInterface) interfaces(ctx context.Context) ([]netif.Interface, error) {
+	if s.name != "" && s.flagsSet == 0 && s.flagsClear == 0 && !s.defaultRoute {
+		iface, err := netif.InterfaceByName(s.name)
+		if err != nil {
+			return nil, err
+		}
+
+		return []netif.Interface{*iface}, nil
+	}
+
+	all, err := netif.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	var ifaces []netif.Interface
+	for _, iface := range all {
+		if s.match(&iface) {
+			ifaces = append(ifaces, iface)
+		}
+	}
+
+	metrics := map[int]int{}
+	if len(ifaces) > 1 || s.defaultRoute {
+		routes, err := netif.RouteTable(s.Type == common.IPv6)
+		if err != nil && s.defaultRoute {
+			return nil, err
+		} else if err != nil {
+			log.S(ctx).Debugw("cannot read route table, interfaces are ordered by index", zap.Error(err))
+		}
+
+		for _, r := range routes {
+			if ones, _ := r.Dst.Mask.Size(); ones != 0 {
+				continue
+			}
+
+			if metric, exist := metrics[r.Index]; !exist || r.Metric < metric {
+				metrics[r.Index] = r.Metric
+			}
+		}
+	}
+
+	if s.defaultRoute {
+		ifaces = slices.DeleteFunc(ifaces, func(iface netif.Interface) bool {
+			_, exist := metrics[iface.Index]
+			return !exist
+		})
+	}
+
+	slices.SortFunc(ifaces, func(a, b netif.Interface) int {
+		ma, okA := metrics[a.Index]
+		mb, okB := metrics[b.Index]
+		switch {
+		case okA && !okB:
+			return -1
+		case !okA && okB:
+			return 1
+		case okA && ma != mb:
+			return ma - mb
+		default:
+			return a.Index - b.Index
+		}
+	})
+
+	if len(ifaces) == 0 {
+		return nil, fmt.Errorf("no interface matched")
+	}
+
+	return ifaces, nil
+}
+
+// candidates returns eligible IP on iface.
+func (s *networkInterface) candidates(ctx context.Context, iface *netif.Interface) (candidate []net.IP, err error) {
 	addrs, err := iface.Addrs()
 	if err != nil {
 		log.S(ctx).Warnw("get address failed", zap.Error(err))
 		return nil, fmt.Errorf(`get address failed: %w`, err)
 	}
 
-	var candidate []net.IP
-
 Next:
 	for _, addr := range addrs {
 		var ip net.IP
@@ -133,25 +303,41 @@ Next:
 		candidate = append(candidate, ip)
 	}
 
-	if len(candidate) == 0 {
-		log.S(ctx).Warnw("no eligible IP found")
-		return nil, fmt.Errorf(`no eligible IP found`)
-	}
+	return candidate, nil
+}
 
-	switch s.Select {
-	case common.SelectShortest:
-		slices.SortStableFunc(candidate, func(i, j net.IP) int {
-			return len(i.String()) - len(j.String())
-		})
-		fallthrough
-	case common.SelectFirst:
-		return candidate[0], nil
-	case common.SelectLast:
-		return candidate[len(candidate)-1], nil
-	default:
-		log.S(ctx).Errorw("unexpected select mode")
-		return nil, fmt.Errorf(`internal error: unexpected select mode`)
+func (s *networkInterface) Watch(ctx context.Context, trigger func()) error {
+	if !s.IPSourceInterfaceConfig.Watch {
+		return nil
 	}
+
+	ctx = log.SWith(ctx, "interface", s.iface, "family", s.Type)
+	log.S(ctx).Infow("watching address changes")
+
+	return netif.WatchAddrs(ctx, func(e netif.AddrEvent) {
+		if e.Index == 0 {
+			log.S(ctx).Warnw("address change events lost")
+			trigger()
+			return
+		}
+
+		var ip net.IP
+		if addr, ok := e.Addr.Addr.(*net.IPNet); ok {
+			ip = addr.IP
+		}
+
+		if ip != nil && (s.Type == common.IPv4) != (ip.To4() != nil) {
+			return
+		}
+
+		// If interface can't be found, it's probably removed, and its addresses are gone as well.
+		if iface, err := netif.InterfaceByIndex(e.Index); err == nil && !s.match(iface) {
+			return
+		}
+
+		log.S(ctx).Infow("address changed", log.IP(ip), "deleted", e.Deleted, "flag", e.Addr.Flags)
+		trigger()
+	})
 }
 
 func newInterface(ctx context.Context, config config.IPSource) (Interface, error) {
@@ -167,5 +353,56 @@ func newInterface(ctx context.Context, config config.IPSource) (Interface, error
 		s.flag |= f
 	}
 
+	// Source is a MAC address, a regex prefixed with "re:", a glob, or an interface name.
+	// Empty source matches any interface.
+	switch {
+	case strings.HasPrefix(s.iface, "re:"):
+		regex, err := regexp.Compile(strings.TrimPrefix(s.iface, "re:"))
+		if err != nil {
+			log.S(ctx).Errorw("bad interface regex", "interface", s.iface, zap.Error(err))
+			return nil, fmt.Errorf("bad interface regex: %w", err)
+		}
+
+		s.regex = regex
+	case strings.ContainsAny(s.iface, "*?["):
+		if _, err := path.Match(s.iface, ""); err != nil {
+			log.S(ctx).Errorw("bad interface glob", "interface", s.iface, zap.Error(err))
+			return nil, fmt.Errorf("bad interface glob: %w", err)
+		}
+
+		s.glob = s.iface
+	default:
+		if mac, err := net.ParseMAC(s.iface); err == nil {
+			s.mac = mac
+		} else {
+			s.name = s.iface
+		}
+	}
+
+	for _, f := range s.InterfaceFlags {
+		name, clear := strings.CutPrefix(f, "!")
+		if name == "default-route" {
+			if clear {
+				log.S(ctx).Errorw("default-route can't be negated")
+				return nil, fmt.Errorf("default-route can't be negated")
+			}
+
+			s.defaultRoute = true
+			continue
+		}
+
+		flag, ok := interfaceFlagNames[name]
+		if !ok {
+			log.S(ctx).Errorw("unknown interface flag", "flag", f)
+			return nil, fmt.Errorf("unknown interface flag %q", f)
+		}
+
+		if clear {
+			s.flagsClear |= flag
+		} else {
+			s.flagsSet |= flag
+		}
+	}
+
 	return s, nil
 }
@@ -0,0 +1,112 @@
+package sources
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/goccy/go-json"
+)
+
+// jsonPath is a JSONPath consisting of only member and array index selectors, like
+// `$.data.ips[0]` or `$["ip address"]`. Elements are either string keys or int indexes.
+type jsonPath []any
+
+func parseJSONPath(path string) (jsonPath, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("json path must start with $")
+	}
+
+	var p jsonPath
+	rest := path[1:]
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end == -1 {
+				end = len(rest) - 1
+			}
+
+			key := rest[1 : end+1]
+			if key == "" {
+				return nil, fmt.Errorf("empty member name in json path at %q", rest)
+			}
+
+			p = append(p, key)
+			rest = rest[end+1:]
+
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end == -1 {
+				return nil, fmt.Errorf("unclosed [ in json path at %q", rest)
+			}
+
+			selector := rest[1:end]
+			if len(selector) >= 2 && (selector[0] == '\'' || selector[0] == '"') && selector[len(selector)-1] == selector[0] {
+				p = append(p, selector[1:len(selector)-1])
+			} else if index, err := strconv.Atoi(selector); err == nil && index >= 0 {
+				p = append(p, index)
+			} else {
+				return nil, fmt.Errorf("bad selector in json path: [%s]", selector)
+			}
+
+			rest = rest[end+1:]
+
+		default:
+			return nil, fmt.Errorf("unexpected character in json path at %q", rest)
+		}
+	}
+
+	return p, nil
+}
+
+// get returns the value at p in a decoded JSON value.
+func (p jsonPath) get(v any) (any, error) {
+	for _, selector := range p {
+		switch selector := selector.(type) {
+		case string:
+			object, ok := v.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("%q: not an object", selector)
+			}
+
+			if v, ok = object[selector]; !ok {
+				return nil, fmt.Errorf("%q: member not found", selector)
+			}
+
+		case int:
+			array, ok := v.([]any)
+			if !ok {
+				return nil, fmt.Errorf("[%d]: not an array", selector)
+			}
+
+			if selector >= len(array) {
+				return nil, fmt.Errorf("[%d]: index out of range", selector)
+			}
+
+			v = array[selector]
+		}
+	}
+
+	return v, nil
+}
+
+// extract returns the string value at p of JSON document data.
+func (p jsonPath) extract(data []byte) ([]byte, error) {
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, fmt.Errorf("bad json: %w", err)
+	}
+
+	v, err := p.get(v)
+	if err != nil {
+		return nil, fmt.Errorf("json path: %w", err)
+	}
+
+	str, ok := v.(string)
+	if !ok {
+		return nil, fmt.Errorf("json path: expect string, got %T", v)
+	}
+
+	return []byte(str), nil
+}
@@ -0,0 +1,98 @@
+package sources
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseJSONPath(t *testing.T) {
+	tests := []struct {
+		path    string
+		want    jsonPath
+		wantErr bool
+	}{
+		{path: "$", want: nil},
+		{path: "$.ip", want: jsonPath{"ip"}},
+		{path: "$.data.ips[0]", want: jsonPath{"data", "ips", 0}},
+		{path: `$["ip address"]`, want: jsonPath{"ip address"}},
+		{path: `$['a.b'][12].c`, want: jsonPath{"a.b", 12, "c"}},
+		{path: "$[0][1]", want: jsonPath{0, 1}},
+		{path: "ip", wantErr: true},
+		{path: "$.", wantErr: true},
+		{path: "$..ip", wantErr: true},
+		{path: "$[0", wantErr: true},
+		{path: "$[-1]", wantErr: true},
+		{path: "$[*]", wantErr: true},
+		{path: "$['ip\"]", wantErr: true},
+		{path: "$ip", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			p, err := parseJSONPath(tt.path)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("path = %v, want error", p)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("err = %v", err)
+			}
+
+			if !slices.Equal(p, tt.want) {
+				t.Errorf("path = %#v, want %#v", p, tt.want)
+			}
+		})
+	}
+}
+
+func TestJSONPathExtract(t *testing.T) {
+	const doc = `{"ip": "192.0.2.1", "data": {"ips": ["192.0.2.2", "192.0.2.3"], "count": 2}, "ip address": "192.0.2.4"}`
+
+	tests := []struct {
+		name    string
+		path    string
+		data    string
+		want    string
+		wantErr bool
+	}{
+		{name: "member", path: "$.ip", data: doc, want: "192.0.2.1"},
+		{name: "nested index", path: "$.data.ips[1]", data: doc, want: "192.0.2.3"},
+		{name: "quoted member", path: `$["ip address"]`, data: doc, want: "192.0.2.4"},
+		{name: "root string", path: "$", data: `"192.0.2.5"`, want: "192.0.2.5"},
+		{name: "root array", path: "$[0].ip", data: `[{"ip": "192.0.2.6"}]`, want: "192.0.2.6"},
+		{name: "missing member", path: "$.addr", data: doc, wantErr: true},
+		{name: "index out of range", path: "$.data.ips[2]", data: doc, wantErr: true},
+		{name: "member of array", path: "$.data.ips.first", data: doc, wantErr: true},
+		{name: "index of object", path: "$.data[0]", data: doc, wantErr: true},
+		{name: "not string", path: "$.data.count", data: doc, wantErr: true},
+		{name: "bad json", path: "$.ip", data: `{"ip": `, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := parseJSONPath(tt.path)
+			if err != nil {
+				t.Fatalf("parse %q: %v", tt.path, err)
+			}
+
+			got, err := p.extract([]byte(tt.data))
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("got %q, want error", got)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("err = %v", err)
+			}
+
+			if string(got) != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -5,6 +5,7 @@
 package netif
 
 import (
+	"context"
 	"errors"
 	"net"
 )
@@ -21,6 +22,7 @@ var (
 	errInvalidInterfaceName     = errors.New("invalid network interface name")
 	errNoSuchInterface          = errors.New("no such network interface")
 	errNoSuchMulticastInterface = errors.New("no such multicast network interface")
+	errWatchUnsupported         = errors.New("watching address changes is not supported")
 )
 
 // Interface represents a mapping between network interface name
@@ -190,3 +192,22 @@ func InterfaceByName(name string) (*Interface, error) {
 	}
 	return nil, &net.OpError{Op: "route", Net: "ip+net", Source: nil, Addr: nil, Err: errNoSuchInterface}
 }
+
+// AddrEvent reports an address added to, changed on or removed from
+// an interface. If Index is zero, some events are lost and the
+// receiver should assume any address may have changed.
+type AddrEvent struct {
+	Index   int
+	Deleted bool
+	Addr    Addr
+}
+
+// WatchAddrs calls fn for every unicast address change of the system,
+// until ctx is done or an error occurs.
+func WatchAddrs(ctx context.Context, fn func(AddrEvent)) error {
+	err := watchAddrs(ctx, fn)
+	if err != nil {
+		err = &net.OpError{Op: "route", Net: "ip+net", Source: nil, Addr: nil, Err: err}
+	}
+	return err
+}
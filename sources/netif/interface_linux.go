@@ -5,10 +5,12 @@
 package netif
 
 import (
+	"context"
 	"encoding/binary"
 	"net"
 	"os"
 	"syscall"
+	"time"
 	"unsafe"
 
 	"golang.org/x/sys/unix"
@@ -241,3 +243,53 @@ func newAddr(ifam *syscall.IfAddrmsg, attrs []syscall.NetlinkRouteAttr) (addr Ad
 	}
 	return
 }
+
+// watchPollInterval bounds how long watchAddrs may take to notice ctx is done.
+const watchPollInterval = time.Second
+
+func watchAddrs(ctx context.Context, fn func(AddrEvent)) error {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_ROUTE)
+	if err != nil {
+		return os.NewSyscallError("socket", err)
+	}
+	defer syscall.Close(fd)
+	sa := &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK, Groups: unix.RTMGRP_IPV4_IFADDR | unix.RTMGRP_IPV6_IFADDR}
+	if err := syscall.Bind(fd, sa); err != nil {
+		return os.NewSyscallError("bind", err)
+	}
+	tv := syscall.NsecToTimeval(int64(watchPollInterval))
+	if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv); err != nil {
+		return os.NewSyscallError("setsockopt", err)
+	}
+	b := make([]byte, 64*1024)
+	for ctx.Err() == nil {
+		n, _, err := syscall.Recvfrom(fd, b, 0)
+		switch err {
+		case nil:
+		case syscall.EAGAIN, syscall.EINTR:
+			continue
+		case syscall.ENOBUFS:
+			// Socket buffer overran, and some events are lost.
+			fn(AddrEvent{})
+			continue
+		default:
+			return os.NewSyscallError("recvfrom", err)
+		}
+		msgs, err := syscall.ParseNetlinkMessage(b[:n])
+		if err != nil {
+			return os.NewSyscallError("parsenetlinkmessage", err)
+		}
+		for _, m := range msgs {
+			switch m.Header.Type {
+			case syscall.RTM_NEWADDR, syscall.RTM_DELADDR:
+				ifam := (*syscall.IfAddrmsg)(unsafe.Pointer(&m.Data[0]))
+				attrs, err := syscall.ParseNetlinkRouteAttr(&m)
+				if err != nil {
+					return os.NewSyscallError("parsenetlinkrouteattr", err)
+				}
+				fn(AddrEvent{Index: int(ifam.Index), Deleted: m.Header.Type == syscall.RTM_DELADDR, Addr: newAddr(ifam, attrs)})
+			}
+		}
+	}
+	return nil
+}
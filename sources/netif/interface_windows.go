@@ -5,6 +5,7 @@
 package netif
 
 import (
+	"context"
 	"net"
 	"os"
 	"syscall"
@@ -211,3 +212,7 @@ func interfaceMulticastAddrTable(ifi *Interface) ([]Addr, error) {
 	}
 	return ifat, nil
 }
+
+func watchAddrs(ctx context.Context, fn func(AddrEvent)) error {
+	return errWatchUnsupported
+}
@@ -0,0 +1,112 @@
+package netif
+
+import (
+	"errors"
+	"net"
+)
+
+var (
+	errRouteUnsupported = errors.New("reading route table is not supported")
+	errNoDefaultRoute   = errors.New("no default route")
+	errNoRoute          = errors.New("no route to destination")
+)
+
+const mainTable = 254
+
+// Route is a unicast route in a routing table.
+type Route struct {
+	Dst     *net.IPNet // destination network, 0.0.0.0/0 or ::/0 for default route
+	Gateway net.IP     // next hop, nil for directly connected networks
+	Src     net.IP     // preferred source address, may be nil
+	Index   int        // index of the outgoing interface
+	Metric  int        // priority, lower is preferred
+}
+
+// RouteTable returns unicast routes in the main routing table, of
+// IPv6 if ipv6 is set, or IPv4 otherwise.
+func RouteTable(ipv6 bool) ([]Route, error) {
+	rt, err := routeTable(ipv6, mainTable)
+	if err != nil {
+		err = &net.OpError{Op: "route", Net: "ip+net", Source: nil, Addr: nil, Err: err}
+	}
+	return rt, err
+}
+
+// DefaultGateway returns the next hop of the preferred default route.
+func DefaultGateway(ipv6 bool) (*Route, error) {
+	rt, err := RouteTable(ipv6)
+	if err != nil {
+		return nil, err
+	}
+	var best *Route
+	for i := range rt {
+		r := &rt[i]
+		if ones, _ := r.Dst.Mask.Size(); ones != 0 || r.Gateway == nil {
+			continue
+		}
+		if best == nil || r.Metric < best.Metric {
+			best = r
+		}
+	}
+	if best == nil {
+		return nil, &net.OpError{Op: "route", Net: "ip+net", Source: nil, Addr: nil, Err: errNoDefaultRoute}
+	}
+	return best, nil
+}
+
+// RouteQuery restricts the route lookup of [RouteGet]. Zero values are ignored.
+type RouteQuery struct {
+	Table int // routing table to look up in
+	Mark  int // firewall mark of the packet
+	Index int // index of the outgoing interface
+}
+
+// RouteGet returns the route the kernel would use to reach dst. Src of the
+// returned route is the source address selected for dst.
+//
+// If q.Table is set, the route is looked up in that table only, and
+// q.Mark is ignored as it only affects routing rules.
+func RouteGet(dst net.IP, q RouteQuery) (r *Route, err error) {
+	if q.Table != 0 {
+		r, err = lookupTable(dst, q)
+	} else {
+		r, err = routeGet(dst, q)
+	}
+	if err != nil {
+		err = &net.OpError{Op: "route", Net: "ip+net", Source: nil, Addr: &net.IPAddr{IP: dst}, Err: err}
+	}
+	return r, err
+}
+
+// lookupTable finds the longest prefix match of dst in table q.Table, as
+// the kernel can't be asked to look up in a specific table.
+func lookupTable(dst net.IP, q RouteQuery) (*Route, error) {
+	rt, err := routeTable(dst.To4() == nil, uint32(q.Table))
+	if err != nil {
+		return nil, err
+	}
+	var best *Route
+	bestOnes := -1
+	for i := range rt {
+		r := &rt[i]
+		if !r.Dst.Contains(dst) || q.Index != 0 && r.Index != q.Index {
+			continue
+		}
+		ones, _ := r.Dst.Mask.Size()
+		if ones > bestOnes || ones == bestOnes && r.Metric < best.Metric {
+			best, bestOnes = r, ones
+		}
+	}
+	if best == nil {
+		return nil, errNoRoute
+	}
+	if best.Src == nil {
+		// Let the kernel select source address on the outgoing interface.
+		r, err := routeGet(dst, RouteQuery{Index: best.Index})
+		if err != nil {
+			return nil, err
+		}
+		best.Src = r.Src
+	}
+	return best, nil
+}
@@ -0,0 +1,150 @@
+package netif
+
+import (
+	"encoding/binary"
+	"net"
+	"os"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+func routeTable(ipv6 bool, table uint32) ([]Route, error) {
+	family, bits := syscall.AF_INET, 8*net.IPv4len
+	if ipv6 {
+		family, bits = syscall.AF_INET6, 8*net.IPv6len
+	}
+	tab, err := syscall.NetlinkRIB(syscall.RTM_GETROUTE, family)
+	if err != nil {
+		return nil, os.NewSyscallError("netlinkrib", err)
+	}
+	msgs, err := syscall.ParseNetlinkMessage(tab)
+	if err != nil {
+		return nil, os.NewSyscallError("parsenetlinkmessage", err)
+	}
+	var rt []Route
+loop:
+	for _, m := range msgs {
+		switch m.Header.Type {
+		case syscall.NLMSG_DONE:
+			break loop
+		case syscall.RTM_NEWROUTE:
+			r, rtable, err := newRoute(&m, bits)
+			if err != nil {
+				return nil, err
+			}
+			if r == nil || rtable != table {
+				continue
+			}
+			rt = append(rt, *r)
+		}
+	}
+	return rt, nil
+}
+
+// newRoute parses a RTM_NEWROUTE message, and returns the route with the
+// table it's in. The route is nil if it's not unicast.
+func newRoute(m *syscall.NetlinkMessage, bits int) (*Route, uint32, error) {
+	rtm := (*syscall.RtMsg)(unsafe.Pointer(&m.Data[0]))
+	if rtm.Type != syscall.RTN_UNICAST {
+		return nil, 0, nil
+	}
+	attrs, err := syscall.ParseNetlinkRouteAttr(m)
+	if err != nil {
+		return nil, 0, os.NewSyscallError("parsenetlinkrouteattr", err)
+	}
+	table := uint32(rtm.Table)
+	r := &Route{Dst: &net.IPNet{IP: make(net.IP, bits/8), Mask: net.CIDRMask(int(rtm.Dst_len), bits)}}
+	for _, a := range attrs {
+		switch a.Attr.Type {
+		case syscall.RTA_TABLE:
+			table = *(*uint32)(unsafe.Pointer(&a.Value[:4][0]))
+		case syscall.RTA_DST:
+			r.Dst.IP = net.IP(a.Value)
+		case syscall.RTA_GATEWAY:
+			r.Gateway = net.IP(a.Value)
+		case syscall.RTA_PREFSRC:
+			r.Src = net.IP(a.Value)
+		case syscall.RTA_OIF:
+			r.Index = int(*(*uint32)(unsafe.Pointer(&a.Value[:4][0])))
+		case syscall.RTA_PRIORITY:
+			r.Metric = int(*(*uint32)(unsafe.Pointer(&a.Value[:4][0])))
+		}
+	}
+	return r, table, nil
+}
+
+func appendRouteAttr(b []byte, typ uint16, value []byte) []byte {
+	b = binary.NativeEndian.AppendUint16(b, uint16(syscall.SizeofRtAttr+len(value)))
+	b = binary.NativeEndian.AppendUint16(b, typ)
+	b = append(b, value...)
+	for len(b)%syscall.NLMSG_ALIGNTO != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+func routeGet(dst net.IP, q RouteQuery) (*Route, error) {
+	family, bits := syscall.AF_INET6, 8*net.IPv6len
+	if ip4 := dst.To4(); ip4 != nil {
+		family, bits = syscall.AF_INET, 8*net.IPv4len
+		dst = ip4
+	}
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_ROUTE)
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+	defer syscall.Close(fd)
+	sa := &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}
+	if err := syscall.Bind(fd, sa); err != nil {
+		return nil, os.NewSyscallError("bind", err)
+	}
+
+	// struct nlmsghdr with length filled at last, followed by
+	// struct rtmsg and attributes.
+	b := make([]byte, syscall.NLMSG_HDRLEN, 128)
+	binary.NativeEndian.PutUint16(b[4:6], syscall.RTM_GETROUTE)
+	binary.NativeEndian.PutUint16(b[6:8], syscall.NLM_F_REQUEST)
+	binary.NativeEndian.PutUint32(b[8:12], 1)
+	b = append(b, byte(family), 0, 0, byte(bits), 0, 0, 0, 0, 0, 0, 0, 0)
+	b = appendRouteAttr(b, syscall.RTA_DST, dst)
+	if q.Mark != 0 {
+		b = appendRouteAttr(b, unix.RTA_MARK, binary.NativeEndian.AppendUint32(nil, uint32(q.Mark)))
+	}
+	if q.Index != 0 {
+		b = appendRouteAttr(b, syscall.RTA_OIF, binary.NativeEndian.AppendUint32(nil, uint32(q.Index)))
+	}
+	binary.NativeEndian.PutUint32(b[0:4], uint32(len(b)))
+
+	if err := syscall.Sendto(fd, b, 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		return nil, os.NewSyscallError("sendto", err)
+	}
+	rb := make([]byte, 64*1024)
+	n, _, err := syscall.Recvfrom(fd, rb, 0)
+	if err != nil {
+		return nil, os.NewSyscallError("recvfrom", err)
+	}
+	msgs, err := syscall.ParseNetlinkMessage(rb[:n])
+	if err != nil {
+		return nil, os.NewSyscallError("parsenetlinkmessage", err)
+	}
+	for _, m := range msgs {
+		switch m.Header.Type {
+		case syscall.NLMSG_ERROR:
+			if errno := -int32(binary.NativeEndian.Uint32(m.Data[:4])); errno != 0 {
+				return nil, os.NewSyscallError("rtm_getroute", syscall.Errno(errno))
+			}
+		case syscall.RTM_NEWROUTE:
+			r, _, err := newRoute(&m, bits)
+			if err != nil {
+				return nil, err
+			}
+			if r == nil {
+				return nil, errNoRoute
+			}
+			return r, nil
+		}
+	}
+	return nil, errNoRoute
+}
@@ -0,0 +1,11 @@
+package netif
+
+import "net"
+
+func routeTable(ipv6 bool, table uint32) ([]Route, error) {
+	return nil, errRouteUnsupported
+}
+
+func routeGet(dst net.IP, q RouteQuery) (*Route, error) {
+	return nil, errRouteUnsupported
+}
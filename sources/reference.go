@@ -7,6 +7,7 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"slices"
 )
 
 type reference struct {
@@ -22,30 +23,38 @@ type referenceRecursiveDetectorType struct{}
 var referenceRecursiveDetectorKey referenceRecursiveDetectorType
 
 func (s *reference) Lookup(ctx context.Context) (net.IP, error) {
+	ips, err := s.LookupAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return ips[0], nil
+}
+
+func (s *reference) LookupAll(ctx context.Context) ([]net.IP, error) {
 	ctx = log.SWith(ctx, "upstream", s.name)
 
-	refChainI := ctx.Value(referenceRecursiveDetectorKey)
-	if refChainI != nil {
-		refChain := refChainI.(*[]string)
-		*refChain = append(*refChain, s.name)
-		for _, node := range (*refChain)[:len(*refChain)-1] {
-			if node == s.name {
-				log.S(ctx).Errorw("infinite loop detected in IP source chain", "chain", *refChain)
-				return nil, fmt.Errorf("infinite loop detected")
-			}
-		}
-	} else {
-		chain := []string{s.name}
-		ctx = context.WithValue(ctx, referenceRecursiveDetectorKey, &chain)
+	var refChain []string
+	if refChainI := ctx.Value(referenceRecursiveDetectorKey); refChainI != nil {
+		refChain = refChainI.([]string)
 	}
 
+	// Never append in place, sibling sources may be following the chain concurrently.
+	refChain = append(slices.Clip(refChain), s.name)
+	if slices.Contains(refChain[:len(refChain)-1], s.name) {
+		log.S(ctx).Errorw("infinite loop detected in IP source chain", "chain", refChain)
+		return nil, fmt.Errorf("infinite loop detected")
+	}
+
+	ctx = context.WithValue(ctx, referenceRecursiveDetectorKey, refChain)
+
 	resolverI := ctx.Value(common.SourceResolverKey)
 	if resolverI == nil {
 		log.S(ctx).Errorw("source resolver not found", log.Internal)
 		return nil, fmt.Errorf("source resolver not found")
 	}
 
-	resolver := resolverI.(func(context.Context, string) (net.IP, error))
+	resolver := resolverI.(func(context.Context, string) ([]net.IP, error))
 	return resolver(ctx, s.name)
 }
 
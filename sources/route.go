@@ -0,0 +1,108 @@
+package sources
+
+import (
+	"cfddns/common"
+	"cfddns/config"
+	"cfddns/log"
+	"cfddns/sources/netif"
+	"context"
+	"fmt"
+	"net"
+
+	"go.uber.org/zap"
+)
+
+type route struct {
+	config.IPSourceRouteConfig `mapstructure:",squash"`
+
+	dst net.IP
+}
+
+func (s *route) Typename() string {
+	return "route"
+}
+
+func (s *route) Family() (common.Family, bool) {
+	if s.dst.To4() != nil {
+		return common.IPv4, true
+	}
+
+	return common.IPv6, true
+}
+
+// connect finds source address by connecting an UDP socket, which doesn't send any packet.
+func (s *route) connect(ctx context.Context) (net.IP, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", net.JoinHostPort(s.dst.String(), "9"))
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Close()
+
+	return conn.LocalAddr().(*net.UDPAddr).IP, nil
+}
+
+// query finds source address with routing table lookup, honoring table, mark and interface.
+func (s *route) query() (net.IP, error) {
+	q := netif.RouteQuery{Table: s.Table, Mark: s.Mark}
+	if s.Interface != "" {
+		iface, err := netif.InterfaceByName(s.Interface)
+		if err != nil {
+			return nil, err
+		}
+
+		q.Index = iface.Index
+	}
+
+	r, err := netif.RouteGet(s.dst, q)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.Src == nil {
+		return nil, fmt.Errorf("no source address selected")
+	}
+
+	return r.Src, nil
+}
+
+func (s *route) Lookup(ctx context.Context) (result net.IP, err error) {
+	ctx = log.SWith(ctx, "destination", s.dst, "table", s.Table, "mark", s.Mark, "interface", s.Interface)
+
+	if s.Table == 0 && s.Mark == 0 && s.Interface == "" {
+		result, err = s.connect(ctx)
+	} else {
+		result, err = s.query()
+	}
+
+	if err != nil {
+		log.S(ctx).Warnw("route lookup failed", zap.Error(err))
+		return nil, fmt.Errorf("route lookup failed: %w", err)
+	}
+
+	if ip4 := result.To4(); ip4 != nil {
+		result = ip4
+	}
+
+	log.S(ctx).Debugw("got ip", log.IP(result))
+	return result, nil
+}
+
+func newRoute(ctx context.Context, config config.IPSource) (Interface, error) {
+	ctx = log.SWith(ctx, "type", "route")
+
+	s := &route{}
+	if err := common.WeakDecodeMap(config.Config, s); err != nil {
+		log.S(ctx).Errorw("bad config", zap.Error(err), "config", config.Config)
+		return nil, fmt.Errorf(`bad config: %w`, err)
+	}
+
+	host, _ := common.DetectNormalizeAddr(config.Source)
+	if s.dst = net.ParseIP(host); s.dst == nil {
+		log.S(ctx).Errorw("destination must be an IP address", "destination", config.Source)
+		return nil, fmt.Errorf("bad destination %q", config.Source)
+	}
+
+	return s, nil
+}
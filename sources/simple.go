@@ -9,30 +9,32 @@ import (
 	"io"
 	"net"
 	"net/http"
-	"net/netip"
 	"regexp"
+	"slices"
+	"strings"
 	"time"
 
 	"go.uber.org/zap"
 )
 
-const maxReadSimple = 4 * 1024
-
-var ipRegex = []*regexp.Regexp{
-	regexp.MustCompile("([0-9]{1,3}\\\\.){3}[0-9]{1,3}(\\\\/([0-9]|[1-2][0-9]|3[0-2]))?"),
-	regexp.MustCompile("s*((([0-9A-Fa-f]{1,4}:){7}([0-9A-Fa-f]{1,4}|:))|(([0-9A-Fa-f]{1,4}:){6}(:[0-9A-Fa-f]{1,4}|((25[0-5]|2[0-4]d|1dd|[1-9]?d)(.(25[0-5]|2[0-4]d|1dd|[1-9]?d)){3})|:))|(([0-9A-Fa-f]{1,4}:){5}(((:[0-9A-Fa-f]{1,4}){1,2})|:((25[0-5]|2[0-4]d|1dd|[1-9]?d)(.(25[0-5]|2[0-4]d|1dd|[1-9]?d)){3})|:))|(([0-9A-Fa-f]{1,4}:){4}(((:[0-9A-Fa-f]{1,4}){1,3})|((:[0-9A-Fa-f]{1,4})?:((25[0-5]|2[0-4]d|1dd|[1-9]?d)(.(25[0-5]|2[0-4]d|1dd|[1-9]?d)){3}))|:))|(([0-9A-Fa-f]{1,4}:){3}(((:[0-9A-Fa-f]{1,4}){1,4})|((:[0-9A-Fa-f]{1,4}){0,2}:((25[0-5]|2[0-4]d|1dd|[1-9]?d)(.(25[0-5]|2[0-4]d|1dd|[1-9]?d)){3}))|:))|(([0-9A-Fa-f]{1,4}:){2}(((:[0-9A-Fa-f]{1,4}){1,5})|((:[0-9A-Fa-f]{1,4}){0,3}:((25[0-5]|2[0-4]d|1dd|[1-9]?d)(.(25[0-5]|2[0-4]d|1dd|[1-9]?d)){3}))|:))|(([0-9A-Fa-f]{1,4}:){1}(((:[0-9A-Fa-f]{1,4}){1,6})|((:[0-9A-Fa-f]{1,4}){0,4}:((25[0-5]|2[0-4]d|1dd|[1-9]?d)(.(25[0-5]|2[0-4]d|1dd|[1-9]?d)){3}))|:))|(:(((:[0-9A-Fa-f]{1,4}){1,7})|((:[0-9A-Fa-f]{1,4}){0,5}:((25[0-5]|2[0-4]d|1dd|[1-9]?d)(.(25[0-5]|2[0-4]d|1dd|[1-9]?d)){3}))|:)))(%.+)?s*(\\/([0-9]|[1-9][0-9]|1[0-1][0-9]|12[0-8]))?"),
-}
+const defaultMaxReadSimple = 4 * 1024
 
 type simple struct {
 	config.IPSourceSimpleConfig `mapstructure:",squash"`
 
-	url string
+	url      string
+	jsonPath jsonPath
+	regex    *regexp.Regexp
 }
 
 func (s *simple) Typename() string {
 	return "simple"
 }
 
+func (s *simple) Family() (common.Family, bool) {
+	return s.Type, true
+}
+
 func (s *simple) wrapDialer(upstream transportDialer) transportDialer {
 	return func(ctx context.Context, network, addr string) (net.Conn, error) {
 		switch s.Type {
@@ -75,12 +77,25 @@ func (s *simple) Lookup(ctx context.Context) (result net.IP, err error) {
 		ctx = tCtx
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "GET", s.url, nil)
+	var body io.Reader
+	if s.Body != "" {
+		body = strings.NewReader(s.Body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, s.Method, s.url, body)
 	if err != nil {
 		log.S(ctx).Errorw("new request failed", zap.Error(err))
 		return nil, fmt.Errorf("new request failed: %w", err)
 	}
 
+	for k, v := range s.Headers {
+		if strings.EqualFold(k, "Host") {
+			req.Host = v
+		} else {
+			req.Header.Set(k, v)
+		}
+	}
+
 	resp, err := client.Do(req)
 	if err != nil {
 		log.S(ctx).Warnw("connection failed", zap.Error(err))
@@ -93,41 +108,42 @@ func (s *simple) Lookup(ctx context.Context) (result net.IP, err error) {
 		}
 	}(resp.Body)
 
-	data, err := io.ReadAll(io.LimitReader(resp.Body, maxReadSimple))
+	data, err := io.ReadAll(io.LimitReader(resp.Body, int64(s.MaxBody)))
 	if err != nil {
 		log.S(ctx).Warnw("receiving response failed", zap.Error(err))
 		return nil, fmt.Errorf(`failed receiving response: %w`, err)
 	}
 
-	ipData := ipRegex[s.Type].Find(data)
-	if ipData == nil {
-		log.S(ctx).Warnw("no IP found in response", log.ByteField("body", data))
-		return nil, fmt.Errorf("no IP found in response")
+	if !s.expectedStatus(resp.StatusCode) {
+		log.S(ctx).Warnw("unexpected status", "status", resp.StatusCode, log.ByteField("body", data))
+		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
 	}
 
-	ipString := string(ipData)
-	nip, err := netip.ParseAddr(ipString)
-	if err != nil {
-		log.S(ctx).Errorw("found bad IP", "ip", ipString, zap.Error(err), log.Internal)
-		return nil, fmt.Errorf(`internal error: found bad IP`)
+	text := data
+	if s.JSONPath != "" {
+		if text, err = s.jsonPath.extract(data); err != nil {
+			log.S(ctx).Warnw("cannot extract value from json", "json_path", s.JSONPath, zap.Error(err), log.ByteField("body", data))
+			return nil, err
+		}
 	}
 
-	switch {
-	case nip.Zone() != "":
-		log.S(ctx).Warnw("found zone in IP", "ip", ipString, "zone", nip.Zone())
-		return nil, fmt.Errorf(`unsupported: found zone in IP`)
+	result, err = extractIP(text, s.regex, s.Type)
+	if err != nil {
+		log.S(ctx).Warnw("no IP found in response", log.ByteField("body", data), zap.Error(err))
+		return nil, fmt.Errorf("no IP found in response: %w", err)
+	}
 
-	case (nip.Is4() || nip.Is4In6()) && s.Type == common.IPv4:
-		ip := nip.As4()
-		return ip[:], nil
+	return result, nil
+}
 
-	case nip.Is6() && s.Type == common.IPv6:
-		ip := nip.As16()
-		return ip[:], nil
-	default:
-		log.S(ctx).Errorw("mismatched IP family", "ip", ipString, log.Internal)
-		return nil, fmt.Errorf(`internal error: mismatched IP family`)
+// expectedStatus reports whether response of status is used. Any status is accepted if not
+// configured, as some services reply IP with odd status codes.
+func (s *simple) expectedStatus(status int) bool {
+	if len(s.Status) == 0 {
+		return true
 	}
+
+	return slices.Contains(s.Status, status)
 }
 
 func newSimple(ctx context.Context, config config.IPSource) (Interface, error) {
@@ -139,5 +155,33 @@ func newSimple(ctx context.Context, config config.IPSource) (Interface, error) {
 		return nil, fmt.Errorf(`bad config: %w`, err)
 	}
 
+	if s.Method == "" {
+		s.Method = "GET"
+	}
+
+	if s.MaxBody <= 0 {
+		s.MaxBody = defaultMaxReadSimple
+	}
+
+	if s.JSONPath != "" {
+		path, err := parseJSONPath(s.JSONPath)
+		if err != nil {
+			log.S(ctx).Errorw("bad json path", "json_path", s.JSONPath, zap.Error(err))
+			return nil, fmt.Errorf("bad json path: %w", err)
+		}
+
+		s.jsonPath = path
+	}
+
+	if s.Regex != "" {
+		regex, err := regexp.Compile(s.Regex)
+		if err != nil {
+			log.S(ctx).Errorw("bad regex", "regex", s.Regex, zap.Error(err))
+			return nil, fmt.Errorf("bad regex: %w", err)
+		}
+
+		s.regex = regex
+	}
+
 	return s, nil
 }
@@ -0,0 +1,76 @@
+package sources
+
+import (
+	"cfddns/config"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSimple(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		config  map[string]any
+		want    string
+		wantErr bool
+	}{
+		{name: "first ip", body: "ip 192.0.2.1, gateway 192.0.2.254", want: "192.0.2.1"},
+		{name: "any status by default", status: http.StatusNotFound, body: "192.0.2.1", want: "192.0.2.1"},
+		{name: "status rejected", status: http.StatusNotFound, body: "192.0.2.1", config: map[string]any{"status": []any{200}}, wantErr: true},
+		{name: "status accepted", status: http.StatusAccepted, body: "192.0.2.1", config: map[string]any{"status": []any{200, 202}}, want: "192.0.2.1"},
+		{name: "json path", body: `{"lan": "192.0.2.1", "wan": {"ip": "192.0.2.2"}}`, config: map[string]any{"json_path": "$.wan.ip"}, want: "192.0.2.2"},
+		{name: "regex", body: "lan=192.0.2.1 wan=192.0.2.2", config: map[string]any{"regex": `wan=([0-9.]+)`}, want: "192.0.2.2"},
+		{name: "request body", body: "192.0.2.1", config: map[string]any{"method": "POST", "body": "192.0.2.3"}, want: "192.0.2.3"},
+		{name: "no ip", body: "nothing here", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// Echo body of POST requests.
+				body := []byte(tt.body)
+				if r.Method == http.MethodPost {
+					body, _ = io.ReadAll(r.Body)
+				}
+
+				if tt.status != 0 {
+					w.WriteHeader(tt.status)
+				}
+
+				_, _ = w.Write(body)
+			}))
+			defer s.Close()
+
+			c := map[string]any{"type": "ipv4"}
+			for k, v := range tt.config {
+				c[k] = v
+			}
+
+			source, err := newSimple(context.Background(), config.IPSource{Type: "simple", Source: s.URL, Config: c})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ip, err := source.Lookup(context.Background())
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ip = %s, want error", ip)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !ip.Equal(net.ParseIP(tt.want)) {
+				t.Errorf("ip = %s, want %s", ip, tt.want)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package sources
 
 import (
+	"cfddns/common"
 	"cfddns/config"
 	"context"
 	"net"
@@ -11,9 +12,32 @@ type Interface interface {
 	Typename() string
 }
 
+// MultiSource is implemented by sources that may yield multiple IP at once.
+type MultiSource interface {
+	LookupAll(ctx context.Context) ([]net.IP, error)
+}
+
+// Watcher is implemented by sources that can notice changes of their result.
+// Watch blocks until ctx is done, and calls trigger whenever the result may have changed.
+type Watcher interface {
+	Watch(ctx context.Context, trigger func()) error
+}
+
+// FamilyHinter is implemented by sources that only yield IP of a known family.
+type FamilyHinter interface {
+	Family() (common.Family, bool)
+}
+
 var Sources = map[string]func(ctx context.Context, source config.IPSource) (Interface, error){
 	"simple":    newSimple,
 	"cf_trace":  newCloudflareTrace,
 	"interface": newInterface,
 	"reference": newReference,
+	"dns":       newDNS,
+	"stun":      newSTUN,
+	"gateway":   newGateway,
+	"exec":      newExec,
+	"route":     newRoute,
+	"static":    newStatic,
+	"file":      newFile,
 }
@@ -0,0 +1,53 @@
+package sources
+
+import (
+	"cfddns/common"
+	"cfddns/config"
+	"cfddns/log"
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+
+	"go.uber.org/zap"
+)
+
+type static struct {
+	ip     net.IP
+	family common.Family
+}
+
+func (s *static) Typename() string {
+	return "static"
+}
+
+func (s *static) Family() (common.Family, bool) {
+	return s.family, true
+}
+
+func (s *static) Lookup(ctx context.Context) (net.IP, error) {
+	log.S(ctx).Debugw("got ip", log.IP(s.ip))
+	return s.ip, nil
+}
+
+func newStatic(ctx context.Context, config config.IPSource) (Interface, error) {
+	ctx = log.SWith(ctx, "type", "static")
+
+	nip, err := netip.ParseAddr(config.Source)
+	if err != nil {
+		log.S(ctx).Errorw("bad ip", "source", config.Source, zap.Error(err))
+		return nil, fmt.Errorf("bad ip: %w", err)
+	}
+
+	s := &static{family: common.IPv6}
+	if nip.Unmap().Is4() {
+		s.family = common.IPv4
+	}
+
+	if s.ip, err = ipOfFamily(nip, s.family); err != nil {
+		log.S(ctx).Errorw("bad ip", "source", config.Source, zap.Error(err))
+		return nil, fmt.Errorf("bad ip: %w", err)
+	}
+
+	return s, nil
+}
@@ -0,0 +1,228 @@
+package sources
+
+import (
+	"bytes"
+	"cfddns/common"
+	"cfddns/config"
+	"cfddns/log"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultSTUNPort    = "3478"
+	defaultSTUNTimeout = 5 * time.Second
+	// Initial retransmission timeout, doubled on each retransmission. See RFC 5389 Section 7.2.1.
+	stunRTO = 500 * time.Millisecond
+
+	stunMagicCookie      = 0x2112A442
+	stunHeaderSize       = 20
+	stunBindingRequest   = 0x0001
+	stunBindingSuccess   = 0x0101
+	stunBindingError     = 0x0111
+	stunMappedAddress    = 0x0001
+	stunXORMappedAddress = 0x0020
+)
+
+type stun struct {
+	config.IPSourceSTUNConfig `mapstructure:",squash"`
+}
+
+func (s *stun) Typename() string {
+	return "stun"
+}
+
+func (s *stun) Family() (common.Family, bool) {
+	return s.Type, true
+}
+
+// parseSTUNAddress decodes value of a (XOR-)MAPPED-ADDRESS attribute. mask is XORed to the
+// address, and is all zero for MAPPED-ADDRESS.
+func parseSTUNAddress(value []byte, mask []byte) (net.IP, error) {
+	if len(value) < 4 {
+		return nil, fmt.Errorf("bad address attribute")
+	}
+
+	var ip net.IP
+	switch value[1] {
+	case 0x01:
+		ip = make(net.IP, net.IPv4len)
+	case 0x02:
+		ip = make(net.IP, net.IPv6len)
+	default:
+		return nil, fmt.Errorf("unknown address family %d", value[1])
+	}
+
+	if len(value) < 4+len(ip) {
+		return nil, fmt.Errorf("bad address attribute")
+	}
+
+	for i := range ip {
+		ip[i] = value[4+i] ^ mask[i]
+	}
+
+	return ip, nil
+}
+
+// parseSTUNResponse extracts mapped address from a Binding response to transaction id.
+func parseSTUNResponse(data []byte, id []byte) (net.IP, error) {
+	if len(data) < stunHeaderSize ||
+		binary.BigEndian.Uint32(data[4:8]) != stunMagicCookie ||
+		!bytes.Equal(data[8:stunHeaderSize], id) {
+		return nil, errSkipResponse
+	}
+
+	switch binary.BigEndian.Uint16(data[0:2]) {
+	case stunBindingSuccess:
+	case stunBindingError:
+		return nil, fmt.Errorf("server replied error")
+	default:
+		return nil, errSkipResponse
+	}
+
+	length := int(binary.BigEndian.Uint16(data[2:4]))
+	if stunHeaderSize+length > len(data) {
+		return nil, fmt.Errorf("truncated response")
+	}
+
+	// XOR-MAPPED-ADDRESS is masked by magic cookie followed by transaction id.
+	xorMask := data[4:stunHeaderSize]
+	zeroMask := make([]byte, net.IPv6len)
+
+	var mapped net.IP
+	attrs := data[stunHeaderSize : stunHeaderSize+length]
+	for len(attrs) >= 4 {
+		attrType := binary.BigEndian.Uint16(attrs[0:2])
+		attrLen := int(binary.BigEndian.Uint16(attrs[2:4]))
+		if 4+attrLen > len(attrs) {
+			return nil, fmt.Errorf("truncated attribute")
+		}
+
+		value := attrs[4 : 4+attrLen]
+		switch attrType {
+		case stunXORMappedAddress:
+			return parseSTUNAddress(value, xorMask)
+		case stunMappedAddress:
+			// Sent by old RFC 3489 servers. Keep looking for XOR-MAPPED-ADDRESS.
+			ip, err := parseSTUNAddress(value, zeroMask)
+			if err != nil {
+				return nil, err
+			}
+
+			mapped = ip
+		}
+
+		// Attributes are padded to 4 bytes.
+		attrs = attrs[min(len(attrs), 4+(attrLen+3)&^3):]
+	}
+
+	if mapped == nil {
+		return nil, fmt.Errorf("no mapped address in response")
+	}
+
+	return mapped, nil
+}
+
+func (s *stun) query(ctx context.Context, server string) (net.IP, error) {
+	network := "udp4"
+	if s.Type == common.IPv6 {
+		network = "udp6"
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, server)
+	if err != nil {
+		return nil, fmt.Errorf("dial failed: %w", err)
+	}
+
+	defer conn.Close()
+
+	request := make([]byte, stunHeaderSize)
+	binary.BigEndian.PutUint16(request[0:2], stunBindingRequest)
+	binary.BigEndian.PutUint32(request[4:8], stunMagicCookie)
+	id := request[8:stunHeaderSize]
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	var ip net.IP
+	err = exchangeUDP(ctx, conn, request, stunRTO, func(response []byte) (err error) {
+		ip, err = parseSTUNResponse(response, id)
+		return err
+	})
+
+	return ip, err
+}
+
+func (s *stun) Lookup(ctx context.Context) (result net.IP, err error) {
+	timeout := time.Duration(s.Timeout)
+	ctx = log.SWith(ctx, "family", s.Type.String(), "timeout", timeout)
+
+	for _, server := range s.Servers {
+		ctx := log.SWith(ctx, "server", server)
+
+		qCtx, cancel := context.WithTimeout(ctx, timeout)
+		result, err = s.query(qCtx, server)
+		cancel()
+
+		if err != nil {
+			log.S(ctx).Warnw("query failed", zap.Error(err))
+			continue
+		}
+
+		if s.Type == common.IPv4 {
+			result = result.To4()
+		} else if result.To4() != nil {
+			result = nil
+		}
+
+		if result == nil {
+			log.S(ctx).Warnw("mapped address has mismatched family")
+			err = fmt.Errorf("mapped address has mismatched family")
+			continue
+		}
+
+		log.S(ctx).Debugw("got ip", log.IP(result))
+		return result, nil
+	}
+
+	return nil, fmt.Errorf("all server failed, last error: %w", err)
+}
+
+func newSTUN(ctx context.Context, config config.IPSource) (Interface, error) {
+	ctx = log.SWith(ctx, "type", "stun")
+
+	s := &stun{}
+	if err := common.WeakDecodeMap(config.Config, s); err != nil {
+		log.S(ctx).Errorw("bad config", zap.Error(err), "config", config.Config)
+		return nil, fmt.Errorf(`bad config: %w`, err)
+	}
+
+	if config.Source != "" {
+		s.Servers = append([]string{config.Source}, s.Servers...)
+	}
+
+	if len(s.Servers) == 0 {
+		log.S(ctx).Errorw("no server configured")
+		return nil, fmt.Errorf("no server configured")
+	}
+
+	for i, server := range s.Servers {
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			host, _ := common.DetectNormalizeAddr(server)
+			s.Servers[i] = net.JoinHostPort(host, defaultSTUNPort)
+		}
+	}
+
+	if s.Timeout <= 0 {
+		s.Timeout = common.Duration(defaultSTUNTimeout)
+	}
+
+	return s, nil
+}
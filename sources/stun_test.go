@@ -0,0 +1,193 @@
+package sources
+
+import (
+	"cfddns/config"
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"testing"
+)
+
+var testSTUNID = []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}
+
+// stunAttr encodes an attribute, padded to 4 bytes.
+func stunAttr(attrType uint16, value []byte) []byte {
+	attr := binary.BigEndian.AppendUint16(nil, attrType)
+	attr = binary.BigEndian.AppendUint16(attr, uint16(len(value)))
+	attr = append(attr, value...)
+	for len(attr)%4 != 0 {
+		attr = append(attr, 0)
+	}
+
+	return attr
+}
+
+// stunAddress encodes value of a (XOR-)MAPPED-ADDRESS attribute of ip. If id is set, it's XORed
+// as in XOR-MAPPED-ADDRESS.
+func stunAddress(ip net.IP, port uint16, id []byte) []byte {
+	family := byte(0x02)
+	if ip4 := ip.To4(); ip4 != nil {
+		family, ip = 0x01, ip4
+	}
+
+	mask := make([]byte, 16)
+	if id != nil {
+		binary.BigEndian.PutUint32(mask, stunMagicCookie)
+		copy(mask[4:], id)
+		port ^= stunMagicCookie >> 16
+	}
+
+	value := []byte{0, family}
+	value = binary.BigEndian.AppendUint16(value, port)
+	for i, b := range ip {
+		value = append(value, b^mask[i])
+	}
+
+	return value
+}
+
+// stunMessage encodes a message of msgType with id and attrs.
+func stunMessage(msgType uint16, id []byte, attrs ...[]byte) []byte {
+	var body []byte
+	for _, attr := range attrs {
+		body = append(body, attr...)
+	}
+
+	msg := binary.BigEndian.AppendUint16(nil, msgType)
+	msg = binary.BigEndian.AppendUint16(msg, uint16(len(body)))
+	msg = binary.BigEndian.AppendUint32(msg, stunMagicCookie)
+	msg = append(msg, id...)
+	return append(msg, body...)
+}
+
+func TestParseSTUNResponse(t *testing.T) {
+	ip4 := net.ParseIP("192.0.2.1")
+	ip6 := net.ParseIP("2001:db8::1")
+	other := net.ParseIP("198.51.100.1")
+	software := stunAttr(0x8022, []byte("test"))
+
+	tests := []struct {
+		name     string
+		data     []byte
+		want     net.IP
+		wantSkip bool
+		wantErr  bool
+	}{
+		{
+			name: "xor mapped ipv4",
+			data: stunMessage(stunBindingSuccess, testSTUNID, stunAttr(stunXORMappedAddress, stunAddress(ip4, 5000, testSTUNID))),
+			want: ip4,
+		},
+		{
+			name: "xor mapped ipv6",
+			data: stunMessage(stunBindingSuccess, testSTUNID, stunAttr(stunXORMappedAddress, stunAddress(ip6, 5000, testSTUNID))),
+			want: ip6,
+		},
+		{
+			name: "mapped of old server",
+			data: stunMessage(stunBindingSuccess, testSTUNID, software, stunAttr(stunMappedAddress, stunAddress(ip4, 5000, nil))),
+			want: ip4,
+		},
+		{
+			name: "xor mapped preferred",
+			data: stunMessage(stunBindingSuccess, testSTUNID,
+				stunAttr(stunMappedAddress, stunAddress(other, 5000, nil)),
+				stunAttr(stunXORMappedAddress, stunAddress(ip4, 5000, testSTUNID))),
+			want: ip4,
+		},
+		{
+			name:     "other transaction",
+			data:     stunMessage(stunBindingSuccess, make([]byte, 12), stunAttr(stunXORMappedAddress, stunAddress(ip4, 5000, make([]byte, 12)))),
+			wantSkip: true,
+		},
+		{
+			name:     "too short",
+			data:     []byte{1, 1, 0, 0},
+			wantSkip: true,
+		},
+		{
+			name:    "error response",
+			data:    stunMessage(stunBindingError, testSTUNID),
+			wantErr: true,
+		},
+		{
+			name:    "no address",
+			data:    stunMessage(stunBindingSuccess, testSTUNID, software),
+			wantErr: true,
+		},
+		{
+			name:    "truncated",
+			data:    stunMessage(stunBindingSuccess, testSTUNID, stunAttr(stunXORMappedAddress, stunAddress(ip4, 5000, testSTUNID)))[:26],
+			wantErr: true,
+		},
+		{
+			name:    "unknown family",
+			data:    stunMessage(stunBindingSuccess, testSTUNID, stunAttr(stunXORMappedAddress, []byte{0, 9, 0, 0, 1, 2, 3, 4})),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ip, err := parseSTUNResponse(tt.data, testSTUNID)
+			switch {
+			case tt.wantSkip:
+				if !errors.Is(err, errSkipResponse) {
+					t.Errorf("err = %v, want skipped", err)
+				}
+			case tt.wantErr:
+				if err == nil || errors.Is(err, errSkipResponse) {
+					t.Errorf("err = %v, want error", err)
+				}
+			case err != nil:
+				t.Errorf("err = %v", err)
+			case !ip.Equal(tt.want):
+				t.Errorf("ip = %s, want %s", ip, tt.want)
+			}
+		})
+	}
+}
+
+// TestSTUNLookup queries a local responder replying the address it sees.
+func TestSTUNLookup(t *testing.T) {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer conn.Close()
+
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+
+			if n < stunHeaderSize || binary.BigEndian.Uint16(buf[0:2]) != stunBindingRequest {
+				continue
+			}
+
+			id := append([]byte{}, buf[8:stunHeaderSize]...)
+			udpAddr := addr.(*net.UDPAddr)
+			_, _ = conn.WriteTo(stunMessage(stunBindingSuccess, id,
+				stunAttr(stunXORMappedAddress, stunAddress(udpAddr.IP, uint16(udpAddr.Port), id))), addr)
+		}
+	}()
+
+	s, err := newSTUN(context.Background(), config.IPSource{Type: "stun", Source: conn.LocalAddr().String(), Config: map[string]any{"type": "ipv4"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ip, err := s.Lookup(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !ip.Equal(net.ParseIP("127.0.0.1")) {
+		t.Errorf("ip = %s, want 127.0.0.1", ip)
+	}
+}
@@ -1,12 +1,18 @@
 package sources
 
 import (
+	"bytes"
+	"cfddns/common"
 	"cfddns/log"
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
+	"net/netip"
 	"reflect"
+	"regexp"
+	"time"
 )
 
 type transportDialer func(ctx context.Context, network, addr string) (net.Conn, error)
@@ -39,3 +45,124 @@ func wrapClientDialer(ctx context.Context, client *http.Client, wrapperBuilder f
 	clientCopy.Transport = transport
 	return &clientCopy, nil
 }
+
+// errSkipResponse is returned by response parsers of exchangeUDP, for packets that are not
+// the expected response and should be ignored.
+var errSkipResponse = errors.New("not a response to our request")
+
+// exchangeUDP sends request over conn until parse accepts a response or ctx is done. The request
+// is retransmitted with interval starting from rto and doubled each time.
+func exchangeUDP(ctx context.Context, conn net.Conn, request []byte, rto time.Duration, parse func([]byte) error) error {
+	deadline, _ := ctx.Deadline()
+	buf := make([]byte, 1500)
+	for ; ; rto *= 2 {
+		if _, err := conn.Write(request); err != nil {
+			return fmt.Errorf("send request failed: %w", err)
+		}
+
+		// Wait until next retransmission, or ctx is done.
+		wait := time.Now().Add(rto)
+		if !deadline.IsZero() && deadline.Before(wait) {
+			wait = deadline
+		}
+
+		if err := conn.SetReadDeadline(wait); err != nil {
+			return err
+		}
+
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				var netErr net.Error
+				if errors.As(err, &netErr) && netErr.Timeout() && ctx.Err() == nil && (deadline.IsZero() || time.Now().Before(deadline)) {
+					break
+				}
+
+				return fmt.Errorf("receive response failed: %w", err)
+			}
+
+			if err := parse(buf[:n]); !errors.Is(err, errSkipResponse) {
+				return err
+			}
+		}
+	}
+}
+
+func isIPChar(r rune) bool {
+	return r >= '0' && r <= '9' || r >= 'a' && r <= 'f' || r >= 'A' && r <= 'F' || r == '.' || r == ':'
+}
+
+// findIP returns the first IP of family in text. Text is split into words of characters
+// that may be part of an IP, so IP in forms like "ip=1.2.3.4" or "2001:db8::1/64" are found.
+func findIP(text []byte, family common.Family) (net.IP, bool) {
+	for _, word := range bytes.FieldsFunc(text, func(r rune) bool { return !isIPChar(r) }) {
+		nip, err := netip.ParseAddr(string(word))
+		if err != nil {
+			continue
+		}
+
+		if ip, err := ipOfFamily(nip, family); err == nil {
+			return ip, true
+		}
+	}
+
+	return nil, false
+}
+
+// ipOfFamily converts nip to net.IP, if it's of family.
+func ipOfFamily(nip netip.Addr, family common.Family) (net.IP, error) {
+	switch {
+	case nip.Zone() != "":
+		return nil, fmt.Errorf(`unsupported: found zone in IP`)
+
+	case (nip.Is4() || nip.Is4In6()) && family == common.IPv4:
+		ip := nip.Unmap().As4()
+		return ip[:], nil
+
+	case nip.Is6() && !nip.Is4In6() && family == common.IPv6:
+		ip := nip.As16()
+		return ip[:], nil
+
+	default:
+		return nil, fmt.Errorf("mismatched IP family")
+	}
+}
+
+// lineOf returns the n-th line of text, starting from 1.
+func lineOf(text []byte, n int) ([]byte, error) {
+	lines := bytes.Split(text, []byte("\n"))
+	if n > len(lines) {
+		return nil, fmt.Errorf("only %d lines found", len(lines))
+	}
+
+	return lines[n-1], nil
+}
+
+// extractIP finds IP of family in text. If regex is set, its match (or the first group if it
+// has any) must be an IP. Otherwise, the first IP of family found in text is used.
+func extractIP(text []byte, regex *regexp.Regexp, family common.Family) (net.IP, error) {
+	if regex == nil {
+		if ip, ok := findIP(text, family); ok {
+			return ip, nil
+		}
+
+		return nil, fmt.Errorf("no IP found")
+	}
+
+	match := regex.FindSubmatch(text)
+	if match == nil {
+		return nil, fmt.Errorf("regex not matched")
+	}
+
+	found := match[0]
+	if len(match) > 1 {
+		found = match[1]
+	}
+
+	nip, err := netip.ParseAddr(string(bytes.TrimSpace(found)))
+	if err != nil {
+		return nil, fmt.Errorf("matched bad IP: %w", err)
+	}
+
+	return ipOfFamily(nip, family)
+}
@@ -18,6 +18,14 @@ type maskRewrite struct {
 	overwrite net.IP
 }
 
+func (t *maskRewrite) Family() (common.Family, bool) {
+	if len(t.overwrite) == net.IPv4len {
+		return common.IPv4, true
+	}
+
+	return common.IPv6, true
+}
+
 func (t *maskRewrite) Transform(ctx context.Context, ip net.IP) (result net.IP, err error) {
 	ctx = log.SWith(ctx, "overwrite", t.overwrite, "mask", t.mask)
 
@@ -1,6 +1,7 @@
 package transformers
 
 import (
+	"cfddns/common"
 	"cfddns/config"
 	"context"
 	"net"
@@ -10,6 +11,11 @@ type Interface interface {
 	Transform(ctx context.Context, ip net.IP) (net.IP, error)
 }
 
+// FamilyHinter is implemented by transformers that only yield IP of a known family.
+type FamilyHinter interface {
+	Family() (common.Family, bool)
+}
+
 var Transformers = map[string]func(ctx context.Context, transformer config.IPTransformer) (Interface, error){
 	"mask_rewrite": newMaskRewrite,
 }